@@ -0,0 +1,97 @@
+package contracts
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/umbracle/go-web3"
+	"github.com/umbracle/go-web3/abi"
+)
+
+// CallObserver, when set, is called with the method and duration of every call made through a Contract.
+// It is set once before any call is made.
+var CallObserver func(method string, duration time.Duration)
+
+// Contract is an Ethereum contract whose calls are sent through a Provider
+type Contract struct {
+	addr     web3.Address
+	abi      *abi.ABI
+	provider Provider
+}
+
+// NewContract creates a new contract instance
+func NewContract(addr web3.Address, abi *abi.ABI, provider Provider) *Contract {
+	return &Contract{
+		addr:     addr,
+		abi:      abi,
+		provider: provider,
+	}
+}
+
+// ABI returns the abi of the contract
+func (c *Contract) ABI() *abi.ABI {
+	return c.abi
+}
+
+// Addr returns the address of the contract
+func (c *Contract) Addr() web3.Address {
+	return c.addr
+}
+
+// Call calls a method in the contract
+func (c *Contract) Call(
+	ctx context.Context, method string, block web3.BlockNumber, args ...interface{},
+) (map[string]interface{}, error) {
+	raw, err := c.CallRaw(ctx, method, block, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode output
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("empty response")
+	}
+	respInterface, err := abi.Decode(c.abi.Methods[method].Outputs, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := respInterface.(map[string]interface{})
+	return resp, nil
+}
+
+// CallRaw calls a method in the contract and returns its undecoded output
+func (c *Contract) CallRaw(
+	ctx context.Context, method string, block web3.BlockNumber, args ...interface{},
+) ([]byte, error) {
+	m, ok := c.abi.Methods[method]
+	if !ok {
+		return nil, fmt.Errorf("method %s not found", method)
+	}
+
+	// Encode input
+	data, err := abi.Encode(args, m.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	data = append(m.ID(), data...)
+
+	// Call function
+	msg := &web3.CallMsg{
+		To:   &c.addr,
+		Data: data,
+	}
+	var rawStr string
+	start := time.Now()
+	err = c.provider.Call(ctx, "eth_call", &rawStr, msg, block.String())
+	if CallObserver != nil {
+		CallObserver(method, time.Since(start))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.TrimPrefix(rawStr, "0x"))
+}
@@ -0,0 +1,105 @@
+package contracts
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/umbracle/go-web3"
+	"github.com/umbracle/go-web3/contract/builtin/erc20"
+)
+
+// ERC20 is the go-web3 builtin ERC20 contract bound to a Provider
+type ERC20 struct {
+	c *Contract
+}
+
+// NewERC20 creates a new instance of the contract at a specific address
+func NewERC20(addr web3.Address, provider Provider) *ERC20 {
+	return &ERC20{c: NewContract(addr, erc20.ERC20Abi(), provider)}
+}
+
+// Contract returns the contract object
+func (e *ERC20) Contract() *Contract {
+	return e.c
+}
+
+// Decimals calls the decimals method in the solidity contract
+func (e *ERC20) Decimals(ctx context.Context, block ...web3.BlockNumber) (retval0 uint8, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = e.c.Call(ctx, "decimals", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(uint8)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+
+	return
+}
+
+// Name calls the name method in the solidity contract
+func (e *ERC20) Name(ctx context.Context, block ...web3.BlockNumber) (retval0 string, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = e.c.Call(ctx, "name", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(string)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+
+	return
+}
+
+// Symbol calls the symbol method in the solidity contract
+func (e *ERC20) Symbol(ctx context.Context, block ...web3.BlockNumber) (retval0 string, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = e.c.Call(ctx, "symbol", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(string)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+
+	return
+}
+
+// TotalSupply calls the totalSupply method in the solidity contract
+func (e *ERC20) TotalSupply(ctx context.Context, block ...web3.BlockNumber) (retval0 *big.Int, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = e.c.Call(ctx, "totalSupply", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+
+	return
+}
@@ -1,11 +1,12 @@
 package contracts
 
 import (
+	"context"
 	"github.com/umbracle/go-web3"
 	"math/big"
 )
 
 type Factory interface {
-	AllPairs(n big.Int, block ...web3.BlockNumber) (retval0 *string, err error)
-	AllPairsLength(block ...web3.BlockNumber) (retval0 *big.Int, err error)
+	AllPairs(ctx context.Context, n big.Int, block ...web3.BlockNumber) (retval0 *string, err error)
+	AllPairsLength(ctx context.Context, block ...web3.BlockNumber) (retval0 *big.Int, err error)
 }
@@ -0,0 +1,101 @@
+package contracts
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/umbracle/go-web3"
+)
+
+// Multicall3 is a solidity contract
+type Multicall3 struct {
+	c *Contract
+}
+
+// Multicall3Call is a single call of an aggregate3 batch
+type Multicall3Call struct {
+	Target       web3.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+// Multicall3Result is the outcome of a single call of an aggregate3 batch
+type Multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// NewMulticall3 creates a new instance of the contract at a specific address
+func NewMulticall3(addr web3.Address, provider Provider) *Multicall3 {
+	return &Multicall3{c: NewContract(addr, Multicall3Abi(), provider)}
+}
+
+// Contract returns the contract object
+func (mc *Multicall3) Contract() *Contract {
+	return mc.c
+}
+
+// Aggregate3 calls the aggregate3 method in the solidity contract
+func (mc *Multicall3) Aggregate3(
+	ctx context.Context, calls []Multicall3Call, block ...web3.BlockNumber,
+) (retval0 []Multicall3Result, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	args := make([]map[string]interface{}, len(calls))
+	for i, call := range calls {
+		args[i] = map[string]interface{}{
+			"target":       call.Target,
+			"allowFailure": call.AllowFailure,
+			"callData":     call.CallData,
+		}
+	}
+
+	out, err = mc.c.Call(ctx, "aggregate3", web3.EncodeBlock(block...), args)
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	results, ok := out["returnData"].([]map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+	retval0 = make([]Multicall3Result, len(results))
+	for i, r := range results {
+		retval0[i].Success, ok = r["success"].(bool)
+		if !ok {
+			err = fmt.Errorf("failed to encode success at index %d", i)
+			return
+		}
+		retval0[i].ReturnData, ok = r["returnData"].([]byte)
+		if !ok {
+			err = fmt.Errorf("failed to encode returnData at index %d", i)
+			return
+		}
+	}
+
+	return
+}
+
+// GetBlockNumber calls the getBlockNumber method in the solidity contract
+func (mc *Multicall3) GetBlockNumber(ctx context.Context, block ...web3.BlockNumber) (retval0 *big.Int, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = mc.c.Call(ctx, "getBlockNumber", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["blockNumber"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+
+	return
+}
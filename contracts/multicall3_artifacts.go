@@ -0,0 +1,35 @@
+package contracts
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/umbracle/go-web3/abi"
+)
+
+var abiMulticall3 *abi.ABI
+
+// Multicall3Abi returns the abi of the Multicall3 contract
+func Multicall3Abi() *abi.ABI {
+	return abiMulticall3
+}
+
+var binMulticall3 []byte
+
+func init() {
+	var err error
+	abiMulticall3, err = abi.NewABI(abiMulticall3Str)
+	if err != nil {
+		panic(fmt.Errorf("cannot parse Multicall3 abi: %v", err))
+	}
+	if len(binMulticall3Str) != 0 {
+		binMulticall3, err = hex.DecodeString(binMulticall3Str[2:])
+		if err != nil {
+			panic(fmt.Errorf("cannot parse Multicall3 bin: %v", err))
+		}
+	}
+}
+
+var binMulticall3Str = ""
+
+var abiMulticall3Str = `[{"inputs":[{"components":[{"internalType":"address","name":"target","type":"address"},{"internalType":"bool","name":"allowFailure","type":"bool"},{"internalType":"bytes","name":"callData","type":"bytes"}],"internalType":"struct Multicall3.Call3[]","name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"internalType":"bool","name":"success","type":"bool"},{"internalType":"bytes","name":"returnData","type":"bytes"}],"internalType":"struct Multicall3.Result[]","name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"},{"inputs":[],"name":"getBlockNumber","outputs":[{"internalType":"uint256","name":"blockNumber","type":"uint256"}],"stateMutability":"view","type":"function"}]`
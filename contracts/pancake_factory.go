@@ -1,35 +1,36 @@
 package contracts
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 
 	"github.com/umbracle/go-web3"
-	"github.com/umbracle/go-web3/contract"
-	"github.com/umbracle/go-web3/jsonrpc"
 )
 
 // PancakeFactory is a solidity contract
 type PancakeFactory struct {
-	c *contract.Contract
+	c *Contract
 }
 
 // NewPancakeFactory creates a new instance of the contract at a specific address
-func NewPancakeFactory(addr web3.Address, provider *jsonrpc.Client) *PancakeFactory {
-	return &PancakeFactory{c: contract.NewContract(addr, PancakeFactoryAbi(), provider)}
+func NewPancakeFactory(addr web3.Address, provider Provider) *PancakeFactory {
+	return &PancakeFactory{c: NewContract(addr, PancakeFactoryAbi(), provider)}
 }
 
 // Contract returns the contract object
-func (pf *PancakeFactory) Contract() *contract.Contract {
+func (pf *PancakeFactory) Contract() *Contract {
 	return pf.c
 }
 
 // AllPairs returns pair at the specific index
-func (pf *PancakeFactory) AllPairs(n int64, block ...web3.BlockNumber) (retval0 web3.Address, err error) {
+func (pf *PancakeFactory) AllPairs(
+	ctx context.Context, n int64, block ...web3.BlockNumber,
+) (retval0 web3.Address, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = pf.c.Call("allPairs", web3.EncodeBlock(block...), n)
+	out, err = pf.c.Call(ctx, "allPairs", web3.EncodeBlock(block...), n)
 	if err != nil {
 		return
 	}
@@ -44,11 +45,11 @@ func (pf *PancakeFactory) AllPairs(n int64, block ...web3.BlockNumber) (retval0
 }
 
 // AllPairsLength returns number of pairs
-func (pf *PancakeFactory) AllPairsLength(block ...web3.BlockNumber) (retval0 *big.Int, err error) {
+func (pf *PancakeFactory) AllPairsLength(ctx context.Context, block ...web3.BlockNumber) (retval0 *big.Int, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = pf.c.Call("allPairsLength", web3.EncodeBlock(block...))
+	out, err = pf.c.Call(ctx, "allPairsLength", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -61,3 +62,13 @@ func (pf *PancakeFactory) AllPairsLength(block ...web3.BlockNumber) (retval0 *bi
 	}
 	return
 }
+
+// PairCreatedEventSig Gets PairCreated event ID
+func (pf *PancakeFactory) PairCreatedEventSig() web3.Hash {
+	return pf.c.ABI().Events["PairCreated"].ID()
+}
+
+// ParsePairCreated decodes a PairCreated log
+func (pf *PancakeFactory) ParsePairCreated(log *web3.Log) (*PairCreatedEvent, error) {
+	return parsePairCreated(pf.c.ABI(), log)
+}
@@ -1,37 +1,36 @@
 package contracts
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 
 	"github.com/umbracle/go-web3"
-	"github.com/umbracle/go-web3/contract"
-	"github.com/umbracle/go-web3/jsonrpc"
 )
 
 // PancakePair is a solidity contract
 type PancakePair struct {
-	c *contract.Contract
+	c *Contract
 }
 
 // NewPancakePair creates a new instance of the contract at a specific address
-func NewPancakePair(addr web3.Address, provider *jsonrpc.Client) *PancakePair {
-	return &PancakePair{c: contract.NewContract(addr, PancakePairAbi(), provider)}
+func NewPancakePair(addr web3.Address, provider Provider) *PancakePair {
+	return &PancakePair{c: NewContract(addr, PancakePairAbi(), provider)}
 }
 
 // Contract returns the contract object
-func (a *PancakePair) Contract() *contract.Contract {
+func (a *PancakePair) Contract() *Contract {
 	return a.c
 }
 
 // calls
 
 // Token0 calls the token0 method in the solidity contract
-func (a *PancakePair) Token0(block ...web3.BlockNumber) (retval0 web3.Address, err error) {
+func (a *PancakePair) Token0(ctx context.Context, block ...web3.BlockNumber) (retval0 web3.Address, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = a.c.Call("token0", web3.EncodeBlock(block...))
+	out, err = a.c.Call(ctx, "token0", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -47,11 +46,11 @@ func (a *PancakePair) Token0(block ...web3.BlockNumber) (retval0 web3.Address, e
 }
 
 // Token1 calls the token1 method in the solidity contract
-func (a *PancakePair) Token1(block ...web3.BlockNumber) (retval0 web3.Address, err error) {
+func (a *PancakePair) Token1(ctx context.Context, block ...web3.BlockNumber) (retval0 web3.Address, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = a.c.Call("token1", web3.EncodeBlock(block...))
+	out, err = a.c.Call(ctx, "token1", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -68,12 +67,12 @@ func (a *PancakePair) Token1(block ...web3.BlockNumber) (retval0 web3.Address, e
 
 // Allowance calls the allowance method in the solidity contract
 func (a *PancakePair) Allowance(
-	owner web3.Address, spender web3.Address, block ...web3.BlockNumber,
+	ctx context.Context, owner web3.Address, spender web3.Address, block ...web3.BlockNumber,
 ) (retval0 *big.Int, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = a.c.Call("allowance", web3.EncodeBlock(block...), owner, spender)
+	out, err = a.c.Call(ctx, "allowance", web3.EncodeBlock(block...), owner, spender)
 	if err != nil {
 		return
 	}
@@ -89,11 +88,13 @@ func (a *PancakePair) Allowance(
 }
 
 // BalanceOf calls the balanceOf method in the solidity contract
-func (a *PancakePair) BalanceOf(owner web3.Address, block ...web3.BlockNumber) (retval0 *big.Int, err error) {
+func (a *PancakePair) BalanceOf(
+	ctx context.Context, owner web3.Address, block ...web3.BlockNumber,
+) (retval0 *big.Int, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = a.c.Call("balanceOf", web3.EncodeBlock(block...), owner)
+	out, err = a.c.Call(ctx, "balanceOf", web3.EncodeBlock(block...), owner)
 	if err != nil {
 		return
 	}
@@ -108,13 +109,14 @@ func (a *PancakePair) BalanceOf(owner web3.Address, block ...web3.BlockNumber) (
 	return
 }
 
+// GetReserves calls the getReserves method in the solidity contract
 func (a *PancakePair) GetReserves(
-	owner web3.Address, block ...web3.BlockNumber,
-) (retval0 *big.Int, retval1 *big.Int, err error) {
+	ctx context.Context, block ...web3.BlockNumber,
+) (retval0 *big.Int, retval1 *big.Int, retval2 uint32, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = a.c.Call("getReserves", web3.EncodeBlock(block...), owner)
+	out, err = a.c.Call(ctx, "getReserves", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -126,21 +128,25 @@ func (a *PancakePair) GetReserves(
 		return
 	}
 	retval1, ok = out["_reserve1"].(*big.Int)
-
 	if !ok {
 		err = fmt.Errorf("failed to encode output at index 1")
 		return
 	}
+	retval2, ok = out["_blockTimestampLast"].(uint32)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 2")
+		return
+	}
 
 	return
 }
 
 // Decimals calls the decimals method in the solidity contract
-func (a *PancakePair) Decimals(block ...web3.BlockNumber) (retval0 uint8, err error) {
+func (a *PancakePair) Decimals(ctx context.Context, block ...web3.BlockNumber) (retval0 uint8, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = a.c.Call("decimals", web3.EncodeBlock(block...))
+	out, err = a.c.Call(ctx, "decimals", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -156,11 +162,11 @@ func (a *PancakePair) Decimals(block ...web3.BlockNumber) (retval0 uint8, err er
 }
 
 // Name calls the name method in the solidity contract
-func (a *PancakePair) Name(block ...web3.BlockNumber) (retval0 string, err error) {
+func (a *PancakePair) Name(ctx context.Context, block ...web3.BlockNumber) (retval0 string, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = a.c.Call("name", web3.EncodeBlock(block...))
+	out, err = a.c.Call(ctx, "name", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -176,11 +182,11 @@ func (a *PancakePair) Name(block ...web3.BlockNumber) (retval0 string, err error
 }
 
 // Symbol calls the symbol method in the solidity contract
-func (a *PancakePair) Symbol(block ...web3.BlockNumber) (retval0 string, err error) {
+func (a *PancakePair) Symbol(ctx context.Context, block ...web3.BlockNumber) (retval0 string, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = a.c.Call("symbol", web3.EncodeBlock(block...))
+	out, err = a.c.Call(ctx, "symbol", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -196,11 +202,11 @@ func (a *PancakePair) Symbol(block ...web3.BlockNumber) (retval0 string, err err
 }
 
 // TotalSupply calls the totalSupply method in the solidity contract
-func (a *PancakePair) TotalSupply(block ...web3.BlockNumber) (retval0 *big.Int, err error) {
+func (a *PancakePair) TotalSupply(ctx context.Context, block ...web3.BlockNumber) (retval0 *big.Int, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = a.c.Call("totalSupply", web3.EncodeBlock(block...))
+	out, err = a.c.Call(ctx, "totalSupply", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -215,21 +221,68 @@ func (a *PancakePair) TotalSupply(block ...web3.BlockNumber) (retval0 *big.Int,
 	return
 }
 
-// txns
+// KLast calls the kLast method in the solidity contract
+func (a *PancakePair) KLast(ctx context.Context, block ...web3.BlockNumber) (retval0 *big.Int, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = a.c.Call(ctx, "kLast", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
 
-// Approve sends a approve transaction in the solidity contract
-func (a *PancakePair) Approve(spender web3.Address, value *big.Int) *contract.Txn {
-	return a.c.Txn("approve", spender, value)
+	return
 }
 
-// Transfer sends a transfer transaction in the solidity contract
-func (a *PancakePair) Transfer(to web3.Address, value *big.Int) *contract.Txn {
-	return a.c.Txn("transfer", to, value)
+// Price0CumulativeLast calls the price0CumulativeLast method in the solidity contract
+func (a *PancakePair) Price0CumulativeLast(
+	ctx context.Context, block ...web3.BlockNumber,
+) (retval0 *big.Int, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = a.c.Call(ctx, "price0CumulativeLast", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+
+	return
 }
 
-// TransferFrom sends a transferFrom transaction in the solidity contract
-func (a *PancakePair) TransferFrom(from web3.Address, to web3.Address, value *big.Int) *contract.Txn {
-	return a.c.Txn("transferFrom", from, to, value)
+// Price1CumulativeLast calls the price1CumulativeLast method in the solidity contract
+func (a *PancakePair) Price1CumulativeLast(
+	ctx context.Context, block ...web3.BlockNumber,
+) (retval0 *big.Int, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = a.c.Call(ctx, "price1CumulativeLast", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+
+	return
 }
 
 // events
@@ -0,0 +1,8 @@
+package contracts
+
+import "context"
+
+// Provider sends JSON-RPC requests to the node. Requests are abandoned once the context is done.
+type Provider interface {
+	Call(ctx context.Context, method string, out interface{}, params ...interface{}) error
+}
@@ -1,35 +1,37 @@
 package contracts
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 
 	"github.com/umbracle/go-web3"
-	"github.com/umbracle/go-web3/contract"
-	"github.com/umbracle/go-web3/jsonrpc"
+	"github.com/umbracle/go-web3/abi"
 )
 
 // UniswapFactory is a solidity contract
 type UniswapFactory struct {
-	c *contract.Contract
+	c *Contract
 }
 
 // NewUniswapFactory creates a new instance of the contract at a specific address
-func NewUniswapFactory(addr web3.Address, provider *jsonrpc.Client) *UniswapFactory {
-	return &UniswapFactory{c: contract.NewContract(addr, UniswapFactoryAbi(), provider)}
+func NewUniswapFactory(addr web3.Address, provider Provider) *UniswapFactory {
+	return &UniswapFactory{c: NewContract(addr, UniswapFactoryAbi(), provider)}
 }
 
 // Contract returns the contract object
-func (usf *UniswapFactory) Contract() *contract.Contract {
+func (usf *UniswapFactory) Contract() *Contract {
 	return usf.c
 }
 
 // AllPairs returns pair at the specific index
-func (usf *UniswapFactory) AllPairs(n int64, block ...web3.BlockNumber) (retval0 web3.Address, err error) {
+func (usf *UniswapFactory) AllPairs(
+	ctx context.Context, n int64, block ...web3.BlockNumber,
+) (retval0 web3.Address, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = usf.c.Call("allPairs", web3.EncodeBlock(block...), n)
+	out, err = usf.c.Call(ctx, "allPairs", web3.EncodeBlock(block...), n)
 	if err != nil {
 		return
 	}
@@ -44,11 +46,13 @@ func (usf *UniswapFactory) AllPairs(n int64, block ...web3.BlockNumber) (retval0
 }
 
 // AllPairsLength returns number of pairs
-func (usf *UniswapFactory) AllPairsLength(block ...web3.BlockNumber) (retval0 *big.Int, err error) {
+func (usf *UniswapFactory) AllPairsLength(
+	ctx context.Context, block ...web3.BlockNumber,
+) (retval0 *big.Int, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = usf.c.Call("allPairsLength", web3.EncodeBlock(block...))
+	out, err = usf.c.Call(ctx, "allPairsLength", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -61,3 +65,54 @@ func (usf *UniswapFactory) AllPairsLength(block ...web3.BlockNumber) (retval0 *b
 	}
 	return
 }
+
+// PairCreatedEvent is a decoded PairCreated log of a Uniswap V2 like factory
+type PairCreatedEvent struct {
+	Token0 web3.Address
+	Token1 web3.Address
+	Pair   web3.Address
+	// Index is the index of the pair in allPairs
+	Index int64
+}
+
+// pairCreatedData is the non indexed data of a PairCreated log, ParseLog skips the unnamed pairs length
+var pairCreatedData = abi.MustNewType("tuple(address pair, uint256 length)")
+
+// PairCreatedEventSig Gets PairCreated event ID
+func (usf *UniswapFactory) PairCreatedEventSig() web3.Hash {
+	return usf.c.ABI().Events["PairCreated"].ID()
+}
+
+// ParsePairCreated decodes a PairCreated log
+func (usf *UniswapFactory) ParsePairCreated(log *web3.Log) (*PairCreatedEvent, error) {
+	return parsePairCreated(usf.c.ABI(), log)
+}
+
+func parsePairCreated(contractAbi *abi.ABI, log *web3.Log) (*PairCreatedEvent, error) {
+	out, err := contractAbi.Events["PairCreated"].ParseLog(log)
+	if err != nil {
+		return nil, err
+	}
+	data, err := abi.Decode(pairCreatedData, log.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	ev := PairCreatedEvent{}
+	var ok bool
+	if ev.Token0, ok = out["token0"].(web3.Address); !ok {
+		return nil, fmt.Errorf("failed to decode token0")
+	}
+	if ev.Token1, ok = out["token1"].(web3.Address); !ok {
+		return nil, fmt.Errorf("failed to decode token1")
+	}
+	if ev.Pair, ok = out["pair"].(web3.Address); !ok {
+		return nil, fmt.Errorf("failed to decode pair")
+	}
+	length, ok := data.(map[string]interface{})["length"].(*big.Int)
+	if !ok || length.Sign() <= 0 {
+		return nil, fmt.Errorf("failed to decode pairs length")
+	}
+	ev.Index = length.Int64() - 1
+	return &ev, nil
+}
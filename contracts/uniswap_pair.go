@@ -1,35 +1,34 @@
 package contracts
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 
 	"github.com/umbracle/go-web3"
-	"github.com/umbracle/go-web3/contract"
-	"github.com/umbracle/go-web3/jsonrpc"
 )
 
 // UniswapPair is a solidity contract
 type UniswapPair struct {
-	c *contract.Contract
+	c *Contract
 }
 
 // NewUniswapPair creates a new instance of the contract at a specific address
-func NewUniswapPair(addr web3.Address, provider *jsonrpc.Client) *UniswapPair {
-	return &UniswapPair{c: contract.NewContract(addr, UniswapPairAbi(), provider)}
+func NewUniswapPair(addr web3.Address, provider Provider) *UniswapPair {
+	return &UniswapPair{c: NewContract(addr, UniswapPairAbi(), provider)}
 }
 
 // Contract returns the contract object
-func (up *UniswapPair) Contract() *contract.Contract {
+func (up *UniswapPair) Contract() *Contract {
 	return up.c
 }
 
 // Token0 calls the token0 method in the solidity contract
-func (up *UniswapPair) Token0(block ...web3.BlockNumber) (retval0 web3.Address, err error) {
+func (up *UniswapPair) Token0(ctx context.Context, block ...web3.BlockNumber) (retval0 web3.Address, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = up.c.Call("token0", web3.EncodeBlock(block...))
+	out, err = up.c.Call(ctx, "token0", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -45,11 +44,11 @@ func (up *UniswapPair) Token0(block ...web3.BlockNumber) (retval0 web3.Address,
 }
 
 // Token1 calls the token1 method in the solidity contract
-func (up *UniswapPair) Token1(block ...web3.BlockNumber) (retval0 web3.Address, err error) {
+func (up *UniswapPair) Token1(ctx context.Context, block ...web3.BlockNumber) (retval0 web3.Address, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = up.c.Call("token1", web3.EncodeBlock(block...))
+	out, err = up.c.Call(ctx, "token1", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -66,12 +65,12 @@ func (up *UniswapPair) Token1(block ...web3.BlockNumber) (retval0 web3.Address,
 
 // Allowance calls the allowance method in the solidity contract
 func (up *UniswapPair) Allowance(
-	owner web3.Address, spender web3.Address, block ...web3.BlockNumber,
+	ctx context.Context, owner web3.Address, spender web3.Address, block ...web3.BlockNumber,
 ) (retval0 *big.Int, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = up.c.Call("allowance", web3.EncodeBlock(block...), owner, spender)
+	out, err = up.c.Call(ctx, "allowance", web3.EncodeBlock(block...), owner, spender)
 	if err != nil {
 		return
 	}
@@ -87,11 +86,13 @@ func (up *UniswapPair) Allowance(
 }
 
 // BalanceOf calls the balanceOf method in the solidity contract
-func (up *UniswapPair) BalanceOf(owner web3.Address, block ...web3.BlockNumber) (retval0 *big.Int, err error) {
+func (up *UniswapPair) BalanceOf(
+	ctx context.Context, owner web3.Address, block ...web3.BlockNumber,
+) (retval0 *big.Int, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = up.c.Call("balanceOf", web3.EncodeBlock(block...), owner)
+	out, err = up.c.Call(ctx, "balanceOf", web3.EncodeBlock(block...), owner)
 	if err != nil {
 		return
 	}
@@ -108,35 +109,42 @@ func (up *UniswapPair) BalanceOf(owner web3.Address, block ...web3.BlockNumber)
 
 // GetReserves calls the getReserves method in the solidity contract
 func (up *UniswapPair) GetReserves(
-	owner web3.Address,
-	block ...web3.BlockNumber,
-) (retval0 *big.Int, retval1 *big.Int, err error) {
+	ctx context.Context, block ...web3.BlockNumber,
+) (retval0 *big.Int, retval1 *big.Int, retval2 uint32, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = up.c.Call("getReserves", web3.EncodeBlock(block...), owner)
+	out, err = up.c.Call(ctx, "getReserves", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
 
 	// decode outputs
 	retval0, ok = out["_reserve0"].(*big.Int)
-	retval1, ok = out["_reserve1"].(*big.Int)
-
 	if !ok {
 		err = fmt.Errorf("failed to encode output at index 0")
 		return
 	}
+	retval1, ok = out["_reserve1"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 1")
+		return
+	}
+	retval2, ok = out["_blockTimestampLast"].(uint32)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 2")
+		return
+	}
 
 	return
 }
 
 // Decimals calls the decimals method in the solidity contract
-func (up *UniswapPair) Decimals(block ...web3.BlockNumber) (retval0 uint8, err error) {
+func (up *UniswapPair) Decimals(ctx context.Context, block ...web3.BlockNumber) (retval0 uint8, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = up.c.Call("decimals", web3.EncodeBlock(block...))
+	out, err = up.c.Call(ctx, "decimals", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -152,11 +160,11 @@ func (up *UniswapPair) Decimals(block ...web3.BlockNumber) (retval0 uint8, err e
 }
 
 // Name calls the name method in the solidity contract
-func (up *UniswapPair) Name(block ...web3.BlockNumber) (retval0 string, err error) {
+func (up *UniswapPair) Name(ctx context.Context, block ...web3.BlockNumber) (retval0 string, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = up.c.Call("name", web3.EncodeBlock(block...))
+	out, err = up.c.Call(ctx, "name", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -172,11 +180,11 @@ func (up *UniswapPair) Name(block ...web3.BlockNumber) (retval0 string, err erro
 }
 
 // Symbol calls the symbol method in the solidity contract
-func (up *UniswapPair) Symbol(block ...web3.BlockNumber) (retval0 string, err error) {
+func (up *UniswapPair) Symbol(ctx context.Context, block ...web3.BlockNumber) (retval0 string, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = up.c.Call("symbol", web3.EncodeBlock(block...))
+	out, err = up.c.Call(ctx, "symbol", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -192,11 +200,11 @@ func (up *UniswapPair) Symbol(block ...web3.BlockNumber) (retval0 string, err er
 }
 
 // TotalSupply calls the totalSupply method in the solidity contract
-func (up *UniswapPair) TotalSupply(block ...web3.BlockNumber) (retval0 *big.Int, err error) {
+func (up *UniswapPair) TotalSupply(ctx context.Context, block ...web3.BlockNumber) (retval0 *big.Int, err error) {
 	var out map[string]interface{}
 	var ok bool
 
-	out, err = up.c.Call("totalSupply", web3.EncodeBlock(block...))
+	out, err = up.c.Call(ctx, "totalSupply", web3.EncodeBlock(block...))
 	if err != nil {
 		return
 	}
@@ -211,21 +219,68 @@ func (up *UniswapPair) TotalSupply(block ...web3.BlockNumber) (retval0 *big.Int,
 	return
 }
 
-// txns
+// KLast calls the kLast method in the solidity contract
+func (up *UniswapPair) KLast(ctx context.Context, block ...web3.BlockNumber) (retval0 *big.Int, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = up.c.Call(ctx, "kLast", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
 
-// Approve sends a approve transaction in the solidity contract
-func (up *UniswapPair) Approve(spender web3.Address, value *big.Int) *contract.Txn {
-	return up.c.Txn("approve", spender, value)
+	return
 }
 
-// Transfer sends a transfer transaction in the solidity contract
-func (up *UniswapPair) Transfer(to web3.Address, value *big.Int) *contract.Txn {
-	return up.c.Txn("transfer", to, value)
+// Price0CumulativeLast calls the price0CumulativeLast method in the solidity contract
+func (up *UniswapPair) Price0CumulativeLast(
+	ctx context.Context, block ...web3.BlockNumber,
+) (retval0 *big.Int, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = up.c.Call(ctx, "price0CumulativeLast", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+
+	return
 }
 
-// TransferFrom sends a transferFrom transaction in the solidity contract
-func (up *UniswapPair) TransferFrom(from web3.Address, to web3.Address, value *big.Int) *contract.Txn {
-	return up.c.Txn("transferFrom", from, to, value)
+// Price1CumulativeLast calls the price1CumulativeLast method in the solidity contract
+func (up *UniswapPair) Price1CumulativeLast(
+	ctx context.Context, block ...web3.BlockNumber,
+) (retval0 *big.Int, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = up.c.Call(ctx, "price1CumulativeLast", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+
+	return
 }
 
 // events
@@ -0,0 +1,113 @@
+package contracts
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/umbracle/go-web3"
+)
+
+// UniswapV1Factory is a vyper contract
+type UniswapV1Factory struct {
+	c *Contract
+}
+
+// NewUniswapV1Factory creates a new instance of the contract at a specific address
+func NewUniswapV1Factory(addr web3.Address, provider Provider) *UniswapV1Factory {
+	return &UniswapV1Factory{c: NewContract(addr, UniswapV1FactoryAbi(), provider)}
+}
+
+// Contract returns the contract object
+func (usf *UniswapV1Factory) Contract() *Contract {
+	return usf.c
+}
+
+// TokenCount returns number of tokens with an exchange
+func (usf *UniswapV1Factory) TokenCount(ctx context.Context, block ...web3.BlockNumber) (retval0 *big.Int, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = usf.c.Call(ctx, "tokenCount", web3.EncodeBlock(block...))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["out"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+	return
+}
+
+// GetTokenWithId returns token with the specific id. Token ids start at 1.
+func (usf *UniswapV1Factory) GetTokenWithId(
+	ctx context.Context, id int64, block ...web3.BlockNumber,
+) (retval0 web3.Address, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = usf.c.Call(ctx, "getTokenWithId", web3.EncodeBlock(block...), big.NewInt(id))
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["out"].(web3.Address)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+	return
+}
+
+// GetExchange returns exchange of the specific token
+func (usf *UniswapV1Factory) GetExchange(
+	ctx context.Context, token web3.Address, block ...web3.BlockNumber,
+) (retval0 web3.Address, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = usf.c.Call(ctx, "getExchange", web3.EncodeBlock(block...), token)
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["out"].(web3.Address)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+	return
+}
+
+// GetToken returns token of the specific exchange
+func (usf *UniswapV1Factory) GetToken(
+	ctx context.Context, exchange web3.Address, block ...web3.BlockNumber,
+) (retval0 web3.Address, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = usf.c.Call(ctx, "getToken", web3.EncodeBlock(block...), exchange)
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["out"].(web3.Address)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+	return
+}
+
+// events
+
+// NewExchangeEventSig Gets NewExchange event ID
+func (usf *UniswapV1Factory) NewExchangeEventSig() web3.Hash {
+	return usf.c.ABI().Events["NewExchange"].ID()
+}
@@ -0,0 +1,35 @@
+package contracts
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/umbracle/go-web3/abi"
+)
+
+var abiUniswapV1Factory *abi.ABI
+
+// UniswapV1FactoryAbi returns the abi of the UniswapV1Factory contract
+func UniswapV1FactoryAbi() *abi.ABI {
+	return abiUniswapV1Factory
+}
+
+var binUniswapV1Factory []byte
+
+func init() {
+	var err error
+	abiUniswapV1Factory, err = abi.NewABI(abiUniswapV1FactoryStr)
+	if err != nil {
+		panic(fmt.Errorf("cannot parse UniswapV1Factory abi: %v", err))
+	}
+	if len(binUniswapV1FactoryStr) != 0 {
+		binUniswapV1Factory, err = hex.DecodeString(binUniswapV1FactoryStr[2:])
+		if err != nil {
+			panic(fmt.Errorf("cannot parse UniswapV1Factory bin: %v", err))
+		}
+	}
+}
+
+var binUniswapV1FactoryStr = ""
+
+var abiUniswapV1FactoryStr = `[{"name":"NewExchange","inputs":[{"type":"address","name":"token","indexed":true},{"type":"address","name":"exchange","indexed":true}],"anonymous":false,"type":"event"},{"name":"initializeFactory","outputs":[],"inputs":[{"type":"address","name":"template"}],"constant":false,"payable":false,"type":"function"},{"name":"createExchange","outputs":[{"type":"address","name":"out"}],"inputs":[{"type":"address","name":"token"}],"constant":false,"payable":false,"type":"function"},{"name":"getExchange","outputs":[{"type":"address","name":"out"}],"inputs":[{"type":"address","name":"token"}],"constant":true,"payable":false,"type":"function"},{"name":"getToken","outputs":[{"type":"address","name":"out"}],"inputs":[{"type":"address","name":"exchange"}],"constant":true,"payable":false,"type":"function"},{"name":"getTokenWithId","outputs":[{"type":"address","name":"out"}],"inputs":[{"type":"uint256","name":"token_id"}],"constant":true,"payable":false,"type":"function"},{"name":"exchangeTemplate","outputs":[{"type":"address","name":"out"}],"inputs":[],"constant":true,"payable":false,"type":"function"},{"name":"tokenCount","outputs":[{"type":"uint256","name":"out"}],"inputs":[],"constant":true,"payable":false,"type":"function"}]`
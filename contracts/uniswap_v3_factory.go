@@ -0,0 +1,113 @@
+package contracts
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/umbracle/go-web3"
+)
+
+// UniswapV3Factory is a solidity contract
+type UniswapV3Factory struct {
+	c *Contract
+}
+
+// PoolCreatedEvent is a decoded PoolCreated log of the UniswapV3Factory contract
+type PoolCreatedEvent struct {
+	Token0      web3.Address
+	Token1      web3.Address
+	Fee         int64
+	TickSpacing int64
+	Pool        web3.Address
+}
+
+// NewUniswapV3Factory creates a new instance of the contract at a specific address
+func NewUniswapV3Factory(addr web3.Address, provider Provider) *UniswapV3Factory {
+	return &UniswapV3Factory{c: NewContract(addr, UniswapV3FactoryAbi(), provider)}
+}
+
+// Contract returns the contract object
+func (usf *UniswapV3Factory) Contract() *Contract {
+	return usf.c
+}
+
+// GetPool returns the pool for the given tokens and fee tier
+func (usf *UniswapV3Factory) GetPool(
+	ctx context.Context, tokenA web3.Address, tokenB web3.Address, fee *big.Int, block ...web3.BlockNumber,
+) (retval0 web3.Address, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = usf.c.Call(ctx, "getPool", web3.EncodeBlock(block...), tokenA, tokenB, fee)
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(web3.Address)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+	return
+}
+
+// FeeAmountTickSpacing returns the tick spacing of the given fee tier
+func (usf *UniswapV3Factory) FeeAmountTickSpacing(
+	ctx context.Context, fee *big.Int, block ...web3.BlockNumber,
+) (retval0 *big.Int, err error) {
+	var out map[string]interface{}
+	var ok bool
+
+	out, err = usf.c.Call(ctx, "feeAmountTickSpacing", web3.EncodeBlock(block...), fee)
+	if err != nil {
+		return
+	}
+
+	// decode outputs
+	retval0, ok = out["0"].(*big.Int)
+	if !ok {
+		err = fmt.Errorf("failed to encode output at index 0")
+		return
+	}
+	return
+}
+
+// events
+
+// PoolCreatedEventSig Gets PoolCreated event ID
+func (usf *UniswapV3Factory) PoolCreatedEventSig() web3.Hash {
+	return usf.c.ABI().Events["PoolCreated"].ID()
+}
+
+// ParsePoolCreated decodes a PoolCreated log
+func (usf *UniswapV3Factory) ParsePoolCreated(log *web3.Log) (*PoolCreatedEvent, error) {
+	out, err := usf.c.ABI().Events["PoolCreated"].ParseLog(log)
+	if err != nil {
+		return nil, err
+	}
+
+	ev := PoolCreatedEvent{}
+	var ok bool
+	if ev.Token0, ok = out["token0"].(web3.Address); !ok {
+		return nil, fmt.Errorf("failed to decode token0")
+	}
+	if ev.Token1, ok = out["token1"].(web3.Address); !ok {
+		return nil, fmt.Errorf("failed to decode token1")
+	}
+	fee, ok := out["fee"].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("failed to decode fee")
+	}
+	ev.Fee = fee.Int64()
+	tickSpacing, ok := out["tickSpacing"].(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("failed to decode tickSpacing")
+	}
+	ev.TickSpacing = tickSpacing.Int64()
+	if ev.Pool, ok = out["pool"].(web3.Address); !ok {
+		return nil, fmt.Errorf("failed to decode pool")
+	}
+	return &ev, nil
+}
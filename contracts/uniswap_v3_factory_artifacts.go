@@ -0,0 +1,35 @@
+package contracts
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/umbracle/go-web3/abi"
+)
+
+var abiUniswapV3Factory *abi.ABI
+
+// UniswapV3FactoryAbi returns the abi of the UniswapV3Factory contract
+func UniswapV3FactoryAbi() *abi.ABI {
+	return abiUniswapV3Factory
+}
+
+var binUniswapV3Factory []byte
+
+func init() {
+	var err error
+	abiUniswapV3Factory, err = abi.NewABI(abiUniswapV3FactoryStr)
+	if err != nil {
+		panic(fmt.Errorf("cannot parse UniswapV3Factory abi: %v", err))
+	}
+	if len(binUniswapV3FactoryStr) != 0 {
+		binUniswapV3Factory, err = hex.DecodeString(binUniswapV3FactoryStr[2:])
+		if err != nil {
+			panic(fmt.Errorf("cannot parse UniswapV3Factory bin: %v", err))
+		}
+	}
+}
+
+var binUniswapV3FactoryStr = ""
+
+var abiUniswapV3FactoryStr = `[{"inputs":[],"stateMutability":"nonpayable","type":"constructor"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"uint24","name":"fee","type":"uint24"},{"indexed":true,"internalType":"int24","name":"tickSpacing","type":"int24"}],"name":"FeeAmountEnabled","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"oldOwner","type":"address"},{"indexed":true,"internalType":"address","name":"newOwner","type":"address"}],"name":"OwnerChanged","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"token0","type":"address"},{"indexed":true,"internalType":"address","name":"token1","type":"address"},{"indexed":true,"internalType":"uint24","name":"fee","type":"uint24"},{"indexed":false,"internalType":"int24","name":"tickSpacing","type":"int24"},{"indexed":false,"internalType":"address","name":"pool","type":"address"}],"name":"PoolCreated","type":"event"},{"inputs":[{"internalType":"uint24","name":"","type":"uint24"}],"name":"feeAmountTickSpacing","outputs":[{"internalType":"int24","name":"","type":"int24"}],"stateMutability":"view","type":"function"},{"inputs":[{"internalType":"address","name":"","type":"address"},{"internalType":"address","name":"","type":"address"},{"internalType":"uint24","name":"","type":"uint24"}],"name":"getPool","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"owner","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"}]`
@@ -0,0 +1,141 @@
+package dex
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"golang.org/x/exp/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var errBatchUnsupported = errors.New("provider does not support batch requests")
+
+// errMissingResponse is the error of a call left out of the reply to its batch, e.g. by a node truncating large
+// batches. The call is likely to succeed when sent again.
+var errMissingResponse = errors.New("missing response")
+
+type rpcCallMsg struct {
+	To   string `json:"to"`
+	Data string `json:"data"`
+}
+
+// BatchTransport sends contract calls as JSON-RPC batch arrays, for nodes without Multicall3 deployed.
+// Nodes rejecting batches are detected on the first batch, after which every call is sent on its own.
+type BatchTransport struct {
+	provider  contracts.Provider
+	batchSize int
+	noBatch   int32
+	logger    *slog.Logger
+}
+
+// NewBatchTransport creates a new BatchTransport sending at most batchSize calls per request
+func NewBatchTransport(provider contracts.Provider, batchSize int) *BatchTransport {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &BatchTransport{
+		provider:  provider,
+		batchSize: batchSize,
+		logger:    slog.Default(),
+	}
+}
+
+// SetLogger sets the logger of the transport, which defaults to slog.Default
+func (bt *BatchTransport) SetLogger(logger *slog.Logger) {
+	bt.logger = logger
+}
+
+// aggregate executes calls in batches and returns their results in the same order
+func (bt *BatchTransport) aggregate(
+	ctx context.Context, calls []contractCall, block web3.BlockNumber,
+) ([]callResult, error) {
+	results := make([]callResult, 0, len(calls))
+	for start := 0; start < len(calls); start += bt.batchSize {
+		end := start + bt.batchSize
+		if end > len(calls) {
+			end = len(calls)
+		}
+
+		requests := make([]rpcRequest, 0, end-start)
+		for i, c := range calls[start:end] {
+			data, err := c.encode()
+			if err != nil {
+				return nil, err
+			}
+			requests = append(requests, rpcRequest{
+				JsonRPC: "2.0",
+				ID:      uint64(i + 1),
+				Method:  "eth_call",
+				Params: []interface{}{
+					rpcCallMsg{To: c.target.String(), Data: "0x" + hex.EncodeToString(data)}, block.String(),
+				},
+			})
+		}
+
+		sent := time.Now()
+		responses, err := bt.sendBatch(ctx, requests)
+		if err != nil {
+			return nil, err
+		}
+		observeCalls(calls[start:end], time.Since(sent))
+		for i, c := range calls[start:end] {
+			results = append(results, decodeCallResponse(c, responses[requests[i].ID]))
+		}
+	}
+	return results, nil
+}
+
+// sendBatch sends requests and returns responses keyed by request id
+func (bt *BatchTransport) sendBatch(ctx context.Context, requests []rpcRequest) (map[uint64]*rpcResponse, error) {
+	bp, ok := bt.provider.(batchProvider)
+	if ok && atomic.LoadInt32(&bt.noBatch) == 0 {
+		responses, err := bp.batchCall(ctx, requests)
+		if err == nil {
+			return responses, nil
+		}
+		if ClassifyError(err) != ErrorClassPermanent {
+			return nil, err
+		}
+		bt.logger.Warn("Batch request rejected, falling back to single calls", "error", err)
+		atomic.StoreInt32(&bt.noBatch, 1)
+	}
+
+	responses := make(map[uint64]*rpcResponse, len(requests))
+	for _, req := range requests {
+		var result json.RawMessage
+		err := bt.provider.Call(ctx, req.Method, &result, req.Params...)
+		if err != nil && ClassifyError(err) != ErrorClassPermanent {
+			return nil, err
+		}
+		res := &rpcResponse{ID: req.ID, Result: result}
+		if err != nil {
+			res.Error = &rpcError{Message: err.Error()}
+		}
+		responses[req.ID] = res
+	}
+	return responses, nil
+}
+
+func decodeCallResponse(c contractCall, res *rpcResponse) callResult {
+	if res == nil {
+		return callResult{err: fmt.Errorf("%w for call %s", errMissingResponse, c.method.Name)}
+	}
+	if res.Error != nil {
+		return callResult{err: res.Error}
+	}
+	var hexData string
+	if err := json.Unmarshal(res.Result, &hexData); err != nil {
+		return callResult{err: err}
+	}
+	raw, err := hex.DecodeString(strings.TrimPrefix(hexData, "0x"))
+	if err != nil {
+		return callResult{err: err}
+	}
+	return c.decode(raw)
+}
@@ -0,0 +1,167 @@
+package dex
+
+import (
+	"context"
+	"errors"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"github.com/umbracle/go-web3/contract/builtin/erc20"
+	"math/big"
+	"sync/atomic"
+	"testing"
+)
+
+var (
+	testUSDC = web3.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	testDAI  = web3.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F")
+	testPair = web3.HexToAddress("0xB4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc")
+)
+
+var testTokens = map[web3.Address]testToken{
+	testUSDC: {symbol: "USDC", name: "USD Coin", decimals: 6, supply: 1000},
+	testDAI:  {symbol: "DAI", name: "Dai Stablecoin", decimals: 18, supply: 2000},
+	testWETH: {symbol: "WETH", name: "Wrapped Ether", decimals: 18, supply: 3000},
+}
+
+// symbols are the outputs of symbolCalls
+var symbols = []string{"USDC", "DAI", "WETH"}
+
+// symbolCalls are the symbol calls of the test tokens, in the order of symbols
+func symbolCalls() []contractCall {
+	var calls []contractCall
+	for _, token := range []web3.Address{testUSDC, testDAI, testWETH} {
+		calls = append(calls, newContractCall(token, erc20.ERC20Abi(), "symbol"))
+	}
+	return calls
+}
+
+func TestBatchTransportCorrelatesReorderedResponses(t *testing.T) {
+	node := newTestNode(t, map[string]rpcHandler{"eth_call": tokenCalls(testTokens)}, func(n *testNode) {
+		n.batchReply = func(requests []testRequest, responses []map[string]interface{}) []map[string]interface{} {
+			for i, j := 0, len(responses)-1; i < j; i, j = i+1, j-1 {
+				responses[i], responses[j] = responses[j], responses[i]
+			}
+			return responses
+		}
+	})
+	bt := NewBatchTransport(NewHTTPTransport(node.URL), 10)
+
+	results, err := bt.aggregate(context.Background(), symbolCalls(), web3.Latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range results {
+		if r.err != nil || r.out["0"] != symbols[i] {
+			t.Errorf("call %d: expected %s, got %v, %v", i, symbols[i], r.out["0"], r.err)
+		}
+	}
+	if node.batchCount() != 1 || node.count("eth_call") != len(symbols) {
+		t.Errorf("expected a single batch of %d calls, got %d batches", len(symbols), node.batchCount())
+	}
+}
+
+func TestBatchTransportMissingResponse(t *testing.T) {
+	node := newTestNode(t, map[string]rpcHandler{"eth_call": tokenCalls(testTokens)}, func(n *testNode) {
+		// the response to the DAI call is left out
+		n.batchReply = func(requests []testRequest, responses []map[string]interface{}) []map[string]interface{} {
+			var kept []map[string]interface{}
+			for i, res := range responses {
+				if !isCall(requests[i], testDAI, erc20.ERC20Abi(), "symbol") {
+					kept = append(kept, res)
+				}
+			}
+			return kept
+		}
+	})
+	bt := NewBatchTransport(NewHTTPTransport(node.URL), 10)
+
+	results, err := bt.aggregate(context.Background(), symbolCalls(), web3.Latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := results[1]; !errors.Is(r.err, errMissingResponse) || ClassifyError(r.err) != ErrorClassRetryable {
+		t.Errorf("expected retryable missing response, got %v", r.err)
+	}
+	for _, i := range []int{0, 2} {
+		if r := results[i]; r.err != nil || r.out["0"] != symbols[i] {
+			t.Errorf("call %d: expected %s, got %v, %v", i, symbols[i], r.out["0"], r.err)
+		}
+	}
+}
+
+func TestBatchTransportFallsBackToSingleCalls(t *testing.T) {
+	node := newTestNode(t, map[string]rpcHandler{"eth_call": tokenCalls(testTokens)}, func(n *testNode) {
+		n.rejectBatches = true
+	})
+	bt := NewBatchTransport(NewHTTPTransport(node.URL), 10)
+	bt.SetLogger(testLogger)
+	ctx := context.Background()
+
+	for run := 0; run < 2; run++ {
+		results, err := bt.aggregate(ctx, symbolCalls(), web3.Latest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, r := range results {
+			if r.err != nil || r.out["0"] != symbols[i] {
+				t.Errorf("run %d, call %d: expected %s, got %v, %v", run, i, symbols[i], r.out["0"], r.err)
+			}
+		}
+	}
+	// only the first batch is tried, every call after it is sent on its own
+	if n := node.batchCount(); n != 1 {
+		t.Errorf("expected 1 batch, got %d", n)
+	}
+	if n := node.count("eth_call"); n != 2*len(symbols) {
+		t.Errorf("expected %d single calls, got %d", 2*len(symbols), n)
+	}
+}
+
+func TestUniswapGetPairsFailsOnMissingResponse(t *testing.T) {
+	calls := map[web3.Address]testContract{
+		testFactory: {abi: contracts.UniswapFactoryAbi(), outputs: map[string]interface{}{"allPairs": testPair}},
+		testPair: {abi: contracts.UniswapPairAbi(), outputs: map[string]interface{}{
+			"symbol": "UNI-V2", "name": "Uniswap V2", "decimals": uint8(18), "token0": testUSDC, "token1": testWETH,
+		}},
+	}
+	for address, token := range testTokens {
+		calls[address] = testContract{abi: erc20.ERC20Abi(), outputs: map[string]interface{}{
+			"symbol": token.symbol, "name": token.name, "decimals": token.decimals, "totalSupply": big.NewInt(token.supply),
+		}}
+	}
+	var dropped int32
+	node := newTestNode(t, map[string]rpcHandler{"eth_call": contractCalls(calls)}, func(n *testNode) {
+		// the first response to a USDC symbol call is left out
+		n.batchReply = func(requests []testRequest, responses []map[string]interface{}) []map[string]interface{} {
+			var kept []map[string]interface{}
+			for i, res := range responses {
+				if isCall(requests[i], testUSDC, erc20.ERC20Abi(), "symbol") && atomic.AddInt32(&dropped, 1) == 1 {
+					continue
+				}
+				kept = append(kept, res)
+			}
+			return kept
+		}
+	})
+	us, err := NewUniswap(testFactory, 1, NewHTTPTransport(node.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us.SetLogger(testLogger)
+	us.EnableBatchTransport(100)
+	ctx := context.Background()
+
+	pairs, errs := us.GetPairs(ctx, 0, 1)
+	if pairs[0] != nil || ClassifyError(errs[0]) != ErrorClassRetryable {
+		t.Fatalf("expected pair to fail with a retryable error, got %+v, %v", pairs[0], errs[0])
+	}
+
+	// the token is not cached without its symbol
+	pairs, errs = us.GetPairs(ctx, 0, 1)
+	if errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+	if pairs[0].Token0Info == nil || pairs[0].Token0Info.Symbol != "USDC" || pairs[0].Name != "Uniswap V2 - USDC/WETH" {
+		t.Errorf("unexpected pair %+v", pairs[0])
+	}
+}
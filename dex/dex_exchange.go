@@ -1,15 +1,30 @@
 package dex
 
 import (
+	"context"
 	"github.com/umbracle/go-web3"
+	"golang.org/x/exp/slog"
 	"math/big"
-	"regexp"
 )
 
-var allowedRegex = regexp.MustCompile("^[ \\w.'+\\-$%/]+$")
 var zeroAddress = web3.HexToAddress("0x0000000000000000000000000000000000000000")
 
+// DexExchange reads the pairs of a DEX. Calls are abandoned once the context is done.
 type DexExchange interface {
-	GetPair(n int64) (*Pair, error)
-	GetPairNumber() (*big.Int, error)
+	GetPair(ctx context.Context, n int64) (*Pair, error)
+	GetPairNumber(ctx context.Context) (*big.Int, error)
+	// SetBlock pins every call made by the exchange to the block
+	SetBlock(block web3.BlockNumber)
+	// SetSanitizePolicy sets the policy token symbols and names are sanitized with
+	SetSanitizePolicy(policy SanitizePolicy)
+	// SetLogger sets the logger of the exchange, which defaults to slog.Default
+	SetLogger(logger *slog.Logger)
+}
+
+// BatchDexExchange is implemented by exchanges able to fetch a range of pairs in batched calls
+type BatchDexExchange interface {
+	DexExchange
+	EnableMulticall(address web3.Address, batchSize int)
+	EnableBatchTransport(batchSize int)
+	GetPairs(ctx context.Context, start int64, end int64) ([]*Pair, []error)
 }
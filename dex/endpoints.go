@@ -0,0 +1,232 @@
+package dex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"golang.org/x/exp/slog"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// latencyWeight is the weight of the newest sample in the moving average of endpoint latency
+const latencyWeight = 0.2
+
+// DefaultCooldown is how long a failing endpoint is taken out of rotation when no cooldown is configured
+const DefaultCooldown = 30 * time.Second
+
+// RequestObserver, when set, is called with the endpoint host, JSON-RPC method and duration of every request
+// sent through an EndpointPool, and the error class of failed requests. The class is empty for requests that
+// succeeded, and the method is "batch" for batches.
+var RequestObserver func(endpoint string, method string, duration time.Duration, class string)
+
+// BalanceStrategy decides which endpoint serves the next call
+type BalanceStrategy string
+
+const (
+	// RoundRobin sends calls to healthy endpoints in turn
+	RoundRobin BalanceStrategy = "round-robin"
+	// LowestLatency sends calls to the healthy endpoint with the lowest observed latency
+	LowestLatency BalanceStrategy = "latency"
+)
+
+// Endpoint is a node serving JSON-RPC requests, limited to RPS requests per second unless RPS is 0
+type Endpoint struct {
+	URL string  `json:"url"`
+	RPS float64 `json:"rps"`
+}
+
+type endpointState struct {
+	url string
+	// host is logged instead of the url, whose path or query string often holds an API key
+	host           string
+	provider       contracts.Provider
+	limiter        *RateLimiter
+	latency        time.Duration
+	unhealthyUntil time.Time
+}
+
+// EndpointPool spreads calls across several endpoints. Endpoints failing with retryable or rate limit
+// errors are taken out of rotation for a cooldown period, so retries go to the remaining endpoints.
+type EndpointPool struct {
+	m         sync.Mutex
+	endpoints []*endpointState
+	strategy  BalanceStrategy
+	cooldown  time.Duration
+	next      int
+	logger    *slog.Logger
+}
+
+// NewEndpointPool creates a new EndpointPool. Every endpoint gets its own rate limiter, and every call
+// sent to an endpoint fails after callTimeout unless it is 0. An empty strategy is RoundRobin and a cooldown
+// of 0 is DefaultCooldown. An adaptive rate needs the RPS of every endpoint, which is the rate it goes back to.
+func NewEndpointPool(
+	endpoints []Endpoint, strategy BalanceStrategy, cooldown time.Duration, adaptiveRate bool,
+	callTimeout time.Duration,
+) (*EndpointPool, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("no endpoints configured")
+	}
+	if strategy == "" {
+		strategy = RoundRobin
+	}
+	if strategy != RoundRobin && strategy != LowestLatency {
+		return nil, fmt.Errorf("unknown balance strategy %s", strategy)
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	pool := &EndpointPool{strategy: strategy, cooldown: cooldown, logger: slog.Default()}
+	for _, e := range endpoints {
+		if adaptiveRate && e.RPS <= 0 {
+			return nil, fmt.Errorf("adaptive rate of endpoint %s needs its rps", endpointHost(e.URL))
+		}
+		provider, err := newTransport(e.URL)
+		if err != nil {
+			return nil, err
+		}
+		// the deadline starts once the rate limiter lets the call through
+		if callTimeout > 0 {
+			provider = &timeoutProvider{provider: provider, timeout: callTimeout}
+		}
+		var limiter *RateLimiter
+		if e.RPS > 0 {
+			limiter = NewRateLimiter(e.RPS, adaptiveRate)
+			provider = &rateLimitedProvider{provider: provider, limiter: limiter}
+		}
+		pool.endpoints = append(pool.endpoints, &endpointState{
+			url: e.URL, host: endpointHost(e.URL), provider: provider, limiter: limiter,
+		})
+	}
+	return pool, nil
+}
+
+// SetLogger sets the logger of the pool and its rate limiters, which defaults to slog.Default
+func (p *EndpointPool) SetLogger(logger *slog.Logger) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.logger = logger
+	for _, e := range p.endpoints {
+		if e.limiter != nil {
+			e.limiter.SetLogger(logger)
+		}
+	}
+}
+
+// pick returns the endpoint serving the next call. When every endpoint is cooling down,
+// the one that recovers first is returned.
+func (p *EndpointPool) pick() *endpointState {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	now := time.Now()
+	var picked *endpointState
+	for i := range p.endpoints {
+		e := p.endpoints[(p.next+i)%len(p.endpoints)]
+		if e.unhealthyUntil.After(now) {
+			continue
+		}
+		if picked == nil || (p.strategy == LowestLatency && e.latency < picked.latency) {
+			picked = e
+		}
+		if p.strategy == RoundRobin {
+			break
+		}
+	}
+	p.next = (p.next + 1) % len(p.endpoints)
+	if picked != nil {
+		return picked
+	}
+
+	for _, e := range p.endpoints {
+		if picked == nil || e.unhealthyUntil.Before(picked.unhealthyUntil) {
+			picked = e
+		}
+	}
+	return picked
+}
+
+// observe records the outcome of a call served by the endpoint
+func (p *EndpointPool) observe(e *endpointState, latency time.Duration, err error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	class := ClassifyError(err)
+	if err != nil && class != ErrorClassPermanent {
+		cooldown := p.cooldown
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > cooldown {
+			cooldown = statusErr.RetryAfter
+		}
+		if e.unhealthyUntil.Before(time.Now()) {
+			p.logger.Warn("Taking endpoint out of rotation", "endpoint", e.host, "cooldown", cooldown, "error", err)
+		}
+		e.unhealthyUntil = time.Now().Add(cooldown)
+		return
+	}
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency += time.Duration(latencyWeight * float64(latency-e.latency))
+	}
+}
+
+// Call makes a jsonrpc call. Calls cancelled by the caller say nothing about the endpoint and are not observed.
+func (p *EndpointPool) Call(ctx context.Context, method string, out interface{}, params ...interface{}) error {
+	e := p.pick()
+	start := time.Now()
+	err := e.provider.Call(ctx, method, out, params...)
+	if ctx.Err() == nil {
+		p.observe(e, time.Since(start), err)
+		observeRequest(e, method, time.Since(start), err)
+	}
+	return err
+}
+
+func (p *EndpointPool) batchCall(ctx context.Context, requests []rpcRequest) (map[uint64]*rpcResponse, error) {
+	e := p.pick()
+	bp, ok := e.provider.(batchProvider)
+	if !ok {
+		return nil, errBatchUnsupported
+	}
+	start := time.Now()
+	responses, err := bp.batchCall(ctx, requests)
+	if ctx.Err() == nil {
+		p.observe(e, time.Since(start), err)
+		observeRequest(e, "batch", time.Since(start), err)
+	}
+	return responses, err
+}
+
+// observeRequest reports a request sent to the endpoint to RequestObserver
+func observeRequest(e *endpointState, method string, duration time.Duration, err error) {
+	if RequestObserver == nil {
+		return
+	}
+	class := ""
+	if err != nil {
+		class = ClassifyError(err).String()
+	}
+	RequestObserver(e.host, method, duration, class)
+}
+
+// endpointHost returns the host of the endpoint URL, as paths and query strings of node URLs often hold API keys
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
+
+// redactURL replaces the URL of a *url.Error within err by its host, so errors of calls can be logged
+// without the API key of the endpoint
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = endpointHost(urlErr.URL)
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package dex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"golang.org/x/exp/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEndpointPoolRedactsURLs(t *testing.T) {
+	// the endpoint is closed, so calls fail with an error of the request
+	node := httptest.NewServer(http.NotFoundHandler())
+	node.Close()
+	endpoint := node.URL + "/v3/secretkey"
+	pool, err := NewEndpointPool([]Endpoint{{URL: endpoint}}, "", 0, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	pool.SetLogger(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	var out string
+	err = pool.Call(context.Background(), "eth_blockNumber", &out)
+	if err == nil {
+		t.Fatal("expected error of a closed endpoint")
+	}
+	if ClassifyError(err) != ErrorClassRetryable {
+		t.Errorf("expected retryable error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "secretkey") {
+		t.Errorf("error holds the endpoint URL: %v", err)
+	}
+	host := strings.TrimPrefix(node.URL, "http://")
+	if !strings.Contains(logs.String(), "endpoint="+host) || strings.Contains(logs.String(), "secretkey") {
+		t.Errorf("expected only the endpoint host logged, got %s", logs.String())
+	}
+}
+
+func TestEndpointPoolObservesRequests(t *testing.T) {
+	node := newTestNode(t, map[string]rpcHandler{
+		"eth_blockNumber": func(params []json.RawMessage) (interface{}, error) { return "0x10", nil },
+	})
+	pool, err := NewEndpointPool([]Endpoint{{URL: node.URL + "/v3/secretkey"}}, "", 0, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.SetLogger(testLogger)
+	var observed []string
+	RequestObserver = func(endpoint string, method string, duration time.Duration, class string) {
+		observed = append(observed, endpoint+" "+method+" "+class)
+	}
+	t.Cleanup(func() { RequestObserver = nil })
+
+	ctx := context.Background()
+	var out string
+	if err := pool.Call(ctx, "eth_blockNumber", &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Call(ctx, "eth_chainId", &out); err == nil {
+		t.Fatal("expected error of an unknown method")
+	}
+	host := strings.TrimPrefix(node.URL, "http://")
+	want := []string{host + " eth_blockNumber ", host + " eth_chainId " + ErrorClassPermanent.String()}
+	if !reflect.DeepEqual(observed, want) {
+		t.Errorf("expected requests %q, got %q", want, observed)
+	}
+}
+
+func TestEndpointPoolAdaptiveRateNeedsRPS(t *testing.T) {
+	endpoints := []Endpoint{{URL: "http://a.example/v3/key", RPS: 10}, {URL: "http://b.example/v3/key"}}
+	if _, err := NewEndpointPool(endpoints, "", 0, true, 0); err == nil || !strings.Contains(err.Error(), "b.example") {
+		t.Errorf("expected error of endpoint b.example without rps, got %v", err)
+	}
+	if _, err := NewEndpointPool(endpoints, "", 0, false, 0); err != nil {
+		t.Errorf("expected endpoints without rps allowed without adaptive rate, got %v", err)
+	}
+	endpoints[1].RPS = 5
+	pool, err := NewEndpointPool(endpoints, "", 0, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range pool.endpoints {
+		if e.limiter == nil || !e.limiter.adaptive {
+			t.Errorf("expected adaptive limiter of endpoint %s", e.host)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package dex
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"github.com/umbracle/go-web3/abi"
+	"time"
+)
+
+// DefaultMulticallAddress is the address of the Multicall3 contract, which is the same on most EVM chains
+var DefaultMulticallAddress = web3.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// DefaultBatchSize is the default number of calls packed into a single batch
+const DefaultBatchSize = 500
+
+// contractCall is a single read-only call of a contract method
+type contractCall struct {
+	target web3.Address
+	method *abi.Method
+	args   []interface{}
+}
+
+// callResult is the decoded output of a contractCall, or the reason it failed. raw holds the
+// undecoded output of calls that did not revert.
+type callResult struct {
+	out map[string]interface{}
+	raw []byte
+	err error
+}
+
+// callBatcher executes many contract calls in a few round trips
+type callBatcher interface {
+	aggregate(ctx context.Context, calls []contractCall, block web3.BlockNumber) ([]callResult, error)
+}
+
+// observeCalls reports batched calls to contracts.CallObserver, as taking as long as their batch
+func observeCalls(calls []contractCall, duration time.Duration) {
+	if contracts.CallObserver == nil {
+		return
+	}
+	for _, c := range calls {
+		contracts.CallObserver(c.method.Name, duration)
+	}
+}
+
+func newContractCall(target web3.Address, contractAbi *abi.ABI, method string, args ...interface{}) contractCall {
+	return contractCall{target: target, method: contractAbi.Methods[method], args: args}
+}
+
+func (c contractCall) encode() ([]byte, error) {
+	data, err := abi.Encode(c.args, c.method.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	return append(c.method.ID(), data...), nil
+}
+
+func (c contractCall) decode(raw []byte) callResult {
+	if len(raw) == 0 {
+		return callResult{raw: raw, err: fmt.Errorf("empty response")}
+	}
+	out, err := abi.Decode(c.method.Outputs, raw)
+	if err != nil {
+		return callResult{raw: raw, err: err}
+	}
+	return callResult{out: out.(map[string]interface{}), raw: raw}
+}
+
+// Multicall packs contract calls into Multicall3 aggregate3 requests. Every call is allowed to
+// fail on its own without failing the rest of the batch.
+type Multicall struct {
+	contract  *contracts.Multicall3
+	batchSize int
+}
+
+// NewMulticall creates a new Multicall sending at most batchSize calls per request
+func NewMulticall(address web3.Address, provider contracts.Provider, batchSize int) *Multicall {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &Multicall{
+		contract:  contracts.NewMulticall3(address, provider),
+		batchSize: batchSize,
+	}
+}
+
+// aggregate executes calls in batches and returns their results in the same order
+func (mc *Multicall) aggregate(
+	ctx context.Context, calls []contractCall, block web3.BlockNumber,
+) ([]callResult, error) {
+	results := make([]callResult, len(calls))
+	for start := 0; start < len(calls); start += mc.batchSize {
+		end := start + mc.batchSize
+		if end > len(calls) {
+			end = len(calls)
+		}
+
+		batch := make([]contracts.Multicall3Call, 0, end-start)
+		for _, c := range calls[start:end] {
+			data, err := c.encode()
+			if err != nil {
+				return nil, err
+			}
+			batch = append(batch, contracts.Multicall3Call{Target: c.target, AllowFailure: true, CallData: data})
+		}
+
+		sent := time.Now()
+		out, err := mc.contract.Aggregate3(ctx, batch, block)
+		if err != nil {
+			return nil, err
+		}
+		observeCalls(calls[start:end], time.Since(sent))
+		if len(out) != len(batch) {
+			return nil, fmt.Errorf("expected %d multicall results, got %d", len(batch), len(out))
+		}
+		for i, r := range out {
+			if !r.Success {
+				results[start+i] = callResult{err: fmt.Errorf("call %s reverted", calls[start+i].method.Name)}
+				continue
+			}
+			results[start+i] = calls[start+i].decode(r.ReturnData)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,227 @@
+package dex
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/umbracle/go-web3"
+	"github.com/umbracle/go-web3/abi"
+	"github.com/umbracle/go-web3/contract/builtin/erc20"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rpcHandler serves a JSON-RPC method of a test node
+type rpcHandler func(params []json.RawMessage) (interface{}, error)
+
+// testNode is a JSON-RPC node serving canned responses over HTTP. Handlers failing with an *rpcError
+// fail the request with that error, and with an *httpStatusError fail the whole HTTP request.
+type testNode struct {
+	*httptest.Server
+	m        sync.Mutex
+	methods  map[string]rpcHandler
+	requests map[string]int
+	batches  int
+	// rejectBatches answers every batch with a single error, like nodes without batch support
+	rejectBatches bool
+	// batchReply, if set, changes the responses to a batch before they are sent, e.g. to reorder or drop them
+	batchReply func(requests []testRequest, responses []map[string]interface{}) []map[string]interface{}
+}
+
+// newTestNode starts a node serving the methods. Options are applied before the node serves any request.
+func newTestNode(t *testing.T, methods map[string]rpcHandler, options ...func(n *testNode)) *testNode {
+	n := &testNode{methods: methods, requests: map[string]int{}}
+	for _, option := range options {
+		option(n)
+	}
+	n.Server = httptest.NewServer(http.HandlerFunc(n.serve))
+	t.Cleanup(n.Close)
+	return n
+}
+
+// count returns the number of requests of the method served so far
+func (n *testNode) count(method string) int {
+	n.m.Lock()
+	defer n.m.Unlock()
+	return n.requests[method]
+}
+
+// batchCount returns the number of batches served so far, rejected ones included
+func (n *testNode) batchCount() int {
+	n.m.Lock()
+	defer n.m.Unlock()
+	return n.batches
+}
+
+type testRequest struct {
+	ID     uint64            `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+func (n *testNode) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var batch []testRequest
+	isBatch := strings.HasPrefix(strings.TrimSpace(string(body)), "[")
+	if isBatch {
+		err = json.Unmarshal(body, &batch)
+	} else {
+		var req testRequest
+		err = json.Unmarshal(body, &req)
+		batch = append(batch, req)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if isBatch {
+		n.m.Lock()
+		n.batches++
+		n.m.Unlock()
+		if n.rejectBatches {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"jsonrpc": "2.0", "id": nil, "error": &rpcError{Code: -32600, Message: "batch requests are disabled"},
+			})
+			return
+		}
+	}
+
+	responses := make([]map[string]interface{}, 0, len(batch))
+	for _, req := range batch {
+		n.m.Lock()
+		n.requests[req.Method]++
+		handler, ok := n.methods[req.Method]
+		n.m.Unlock()
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if !ok {
+			res["error"] = &rpcError{Code: -32601, Message: "method not found"}
+			responses = append(responses, res)
+			continue
+		}
+		result, err := handler(req.Params)
+		var statusErr *httpStatusError
+		var rpcErr *rpcError
+		switch {
+		case errors.As(err, &statusErr):
+			if statusErr.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(statusErr.RetryAfter.Seconds())))
+			}
+			http.Error(w, statusErr.Body, statusErr.StatusCode)
+			return
+		case errors.As(err, &rpcErr):
+			res["error"] = rpcErr
+		case err != nil:
+			res["error"] = &rpcError{Code: -32000, Message: err.Error()}
+		default:
+			res["result"] = result
+		}
+		responses = append(responses, res)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !isBatch {
+		json.NewEncoder(w).Encode(responses[0])
+		return
+	}
+	if n.batchReply != nil {
+		responses = n.batchReply(batch, responses)
+	}
+	json.NewEncoder(w).Encode(responses)
+}
+
+// testToken is the ERC20 metadata served by tokenCalls
+type testToken struct {
+	symbol   string
+	name     string
+	decimals uint8
+	supply   int64
+}
+
+// tokenCalls serves eth_call of the ERC20 metadata methods of the tokens. Calls of other contracts
+// or methods revert.
+func tokenCalls(tokens map[web3.Address]testToken) rpcHandler {
+	contracts := map[web3.Address]testContract{}
+	for address, token := range tokens {
+		contracts[address] = testContract{abi: erc20.ERC20Abi(), outputs: map[string]interface{}{
+			"symbol":      token.symbol,
+			"name":        token.name,
+			"decimals":    token.decimals,
+			"totalSupply": big.NewInt(token.supply),
+		}}
+	}
+	return contractCalls(contracts)
+}
+
+// testContract is a contract served by contractCalls, whose methods return the same output for any arguments
+type testContract struct {
+	abi     *abi.ABI
+	outputs map[string]interface{}
+}
+
+// contractCalls serves eth_call of the methods of the contracts. Calls of other contracts or methods revert.
+func contractCalls(contracts map[web3.Address]testContract) rpcHandler {
+	return func(params []json.RawMessage) (interface{}, error) {
+		var msg struct {
+			To   web3.Address `json:"to"`
+			Data string       `json:"data"`
+		}
+		if err := json.Unmarshal(params[0], &msg); err != nil {
+			return nil, err
+		}
+		contract, ok := contracts[msg.To]
+		if !ok {
+			return nil, &rpcError{Code: 3, Message: "execution reverted"}
+		}
+		data, err := hex.DecodeString(strings.TrimPrefix(msg.Data, "0x"))
+		if err != nil || len(data) < 4 {
+			return nil, &rpcError{Code: 3, Message: "execution reverted"}
+		}
+		for name, method := range contract.abi.Methods {
+			value, ok := contract.outputs[name]
+			if !ok || hex.EncodeToString(method.ID()) != hex.EncodeToString(data[:4]) {
+				continue
+			}
+			out, err := abi.Encode([]interface{}{value}, method.Outputs)
+			if err != nil {
+				return nil, err
+			}
+			return "0x" + hex.EncodeToString(out), nil
+		}
+		return nil, &rpcError{Code: 3, Message: "execution reverted"}
+	}
+}
+
+// isCall tells whether the request is an eth_call of the method of the ABI on the contract
+func isCall(req testRequest, contract web3.Address, contractAbi *abi.ABI, method string) bool {
+	if req.Method != "eth_call" || len(req.Params) == 0 {
+		return false
+	}
+	var msg struct {
+		To   web3.Address `json:"to"`
+		Data string       `json:"data"`
+	}
+	if json.Unmarshal(req.Params[0], &msg) != nil || msg.To != contract {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimPrefix(msg.Data, "0x"), hex.EncodeToString(contractAbi.Methods[method].ID()))
+}
+
+// parseQuantity parses a hex encoded JSON-RPC quantity
+func parseQuantity(raw json.RawMessage) (uint64, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
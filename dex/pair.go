@@ -1,11 +1,22 @@
 package dex
 
 type Pair struct {
-	Token0   string `json:"token0"`
-	Token1   string `json:"token1"`
-	Name     string `json:"name"`
-	Address  string `json:"address"`
-	Symbol   string `json:"symbol"`
-	Decimals int    `json:"decimals"`
-	ChainId  int    `json:"chainId"`
+	Index       int64      `json:"index"`
+	Token0      string     `json:"token0"`
+	Token1      string     `json:"token1"`
+	Token0Info  *Token     `json:"token0Info,omitempty"`
+	Token1Info  *Token     `json:"token1Info,omitempty"`
+	Name        string     `json:"name"`
+	Address     string     `json:"address"`
+	Symbol      string     `json:"symbol"`
+	Decimals    int        `json:"decimals"`
+	ChainId     int        `json:"chainId"`
+	Fee         int64      `json:"fee,omitempty"`
+	TickSpacing int64      `json:"tickSpacing,omitempty"`
+	State       *PairState `json:"state,omitempty"`
+	// BlockNumber and BlockHash are the block a watched pair was created in
+	BlockNumber uint64 `json:"blockNumber,omitempty"`
+	BlockHash   string `json:"blockHash,omitempty"`
+	// Pending is set on watched pairs which do not have enough confirmations yet and may be dropped by a reorg
+	Pending bool `json:"pending,omitempty"`
 }
@@ -0,0 +1,135 @@
+package dex
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"math/big"
+	"strings"
+)
+
+// getPairsOneByOne fetches the [start, end) range of pairs with a GetPair call per pair
+func getPairsOneByOne(ctx context.Context, d DexExchange, start int64, end int64) ([]*Pair, []error) {
+	pairs := make([]*Pair, end-start)
+	errs := make([]error, end-start)
+	for i := start; i < end; i++ {
+		pairs[i-start], errs[i-start] = d.GetPair(ctx, i)
+	}
+	return pairs, errs
+}
+
+// getV2Pairs fetches the [start, end) range of pairs of a UniswapV2-like factory. All pair and token
+// reads are batched, so the whole range takes a handful of round trips.
+func getV2Pairs(
+	ctx context.Context, b callBatcher, tokens *tokenCache, factory *contracts.Contract, start int64, end int64,
+	chainId int, block web3.BlockNumber,
+) ([]*Pair, []error) {
+	pairs := make([]*Pair, end-start)
+	errs := make([]error, end-start)
+	setErr := func(err error) ([]*Pair, []error) {
+		for i := range errs {
+			errs[i] = err
+		}
+		return pairs, errs
+	}
+
+	// pair addresses
+	calls := make([]contractCall, 0, end-start)
+	for i := start; i < end; i++ {
+		calls = append(calls, newContractCall(factory.Addr(), factory.ABI(), "allPairs", big.NewInt(i)))
+	}
+	results, err := b.aggregate(ctx, calls, block)
+	if err != nil {
+		return setErr(err)
+	}
+	pairAddresses := make([]web3.Address, end-start)
+	for i, r := range results {
+		if r.err != nil {
+			errs[i] = r.err
+			continue
+		}
+		pairAddresses[i] = r.out["0"].(web3.Address)
+	}
+
+	// pair metadata
+	pairMethods := []string{"symbol", "name", "decimals", "token0", "token1"}
+	calls = calls[:0]
+	for i, pairAddress := range pairAddresses {
+		if errs[i] != nil {
+			continue
+		}
+		for _, method := range pairMethods {
+			calls = append(calls, newContractCall(pairAddress, contracts.UniswapPairAbi(), method))
+		}
+	}
+	results, err = b.aggregate(ctx, calls, block)
+	if err != nil {
+		return setErr(err)
+	}
+	var pairTokens []web3.Address
+	seen := map[web3.Address]bool{}
+	for i, pairAddress := range pairAddresses {
+		if errs[i] != nil {
+			continue
+		}
+		r := results[:len(pairMethods)]
+		results = results[len(pairMethods):]
+		for _, res := range r {
+			if err := callError(ctx, res.err); err != nil {
+				errs[i] = err
+				break
+			}
+		}
+		if errs[i] != nil {
+			continue
+		}
+
+		pairSymbol, _ := r[0].out["0"].(string)
+		pairName, _ := r[1].out["0"].(string)
+		pairDecimals, _ := r[2].out["0"].(uint8)
+		token0, _ := r[3].out["0"].(web3.Address)
+		token1, _ := r[4].out["0"].(web3.Address)
+		for _, token := range []web3.Address{token0, token1} {
+			if !seen[token] && token != zeroAddress {
+				seen[token] = true
+				pairTokens = append(pairTokens, token)
+			}
+		}
+
+		pairs[i] = &Pair{
+			Index:    start + int64(i),
+			Token0:   strings.ToLower(token0.String()),
+			Token1:   strings.ToLower(token1.String()),
+			Name:     pairName,
+			Address:  strings.ToLower(pairAddress.String()),
+			Symbol:   pairSymbol,
+			Decimals: int(pairDecimals),
+			ChainId:  chainId,
+		}
+	}
+
+	// token metadata, each token is fetched once for all pairs of the exchange
+	tokenInfos, tokenErrs, err := tokens.getBatch(ctx, b, pairTokens, block)
+	if err != nil {
+		return setErr(err)
+	}
+	for i, pair := range pairs {
+		if pair == nil {
+			continue
+		}
+		// pairs with a token that could not be fetched fail, so they are fetched again on resume
+		if err := tokenErrs[web3.HexToAddress(pair.Token0)]; err != nil {
+			pairs[i], errs[i] = nil, err
+			continue
+		}
+		if err := tokenErrs[web3.HexToAddress(pair.Token1)]; err != nil {
+			pairs[i], errs[i] = nil, err
+			continue
+		}
+		pair.Token0Info = tokenInfos[web3.HexToAddress(pair.Token0)]
+		pair.Token1Info = tokenInfos[web3.HexToAddress(pair.Token1)]
+		pair.Name = fmt.Sprintf("%s - %s/%s", pair.Name, tokens.symbol(pair.Token0Info), tokens.symbol(pair.Token1Info))
+	}
+	return pairs, errs
+}
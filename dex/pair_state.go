@@ -0,0 +1,130 @@
+package dex
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"math/big"
+)
+
+// PairState is the liquidity state of a pair at a block. Amounts are decimal strings,
+// as they do not fit into JSON numbers.
+type PairState struct {
+	Block                uint64 `json:"block"`
+	Reserve0             string `json:"reserve0"`
+	Reserve1             string `json:"reserve1"`
+	BlockTimestampLast   uint32 `json:"blockTimestampLast"`
+	TotalSupply          string `json:"totalSupply"`
+	KLast                string `json:"kLast"`
+	Price0CumulativeLast string `json:"price0CumulativeLast"`
+	Price1CumulativeLast string `json:"price1CumulativeLast"`
+}
+
+// StateDexExchange is a DexExchange able to read the liquidity state of its pairs
+type StateDexExchange interface {
+	DexExchange
+	// GetPairStates sets the state of every pair at the block and returns an error per pair
+	GetPairStates(ctx context.Context, pairs []*Pair, block uint64) []error
+}
+
+// v2StateMethods are the UniswapV2 pair methods making up the pair state
+var v2StateMethods = []string{"getReserves", "totalSupply", "kLast", "price0CumulativeLast", "price1CumulativeLast"}
+
+// getV2PairStates reads the state of UniswapV2-like pairs at the block, batched when b is not nil
+func getV2PairStates(
+	ctx context.Context, b callBatcher, provider contracts.Provider, pairs []*Pair, block uint64,
+) []error {
+	errs := make([]error, len(pairs))
+	if b == nil {
+		for i, pair := range pairs {
+			pair.State, errs[i] = getV2PairState(ctx, provider, pair, block)
+		}
+		return errs
+	}
+
+	calls := make([]contractCall, 0, len(pairs)*len(v2StateMethods))
+	for _, pair := range pairs {
+		for _, method := range v2StateMethods {
+			calls = append(calls, newContractCall(web3.HexToAddress(pair.Address), contracts.UniswapPairAbi(), method))
+		}
+	}
+	results, err := b.aggregate(ctx, calls, web3.BlockNumber(block))
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	for i, pair := range pairs {
+		r := results[i*len(v2StateMethods) : (i+1)*len(v2StateMethods)]
+		errs[i] = firstCallError(r)
+		if errs[i] != nil {
+			continue
+		}
+		timestamp, _ := r[0].out["_blockTimestampLast"].(uint32)
+		pair.State = &PairState{
+			Block:                block,
+			Reserve0:             bigString(r[0].out["_reserve0"]),
+			Reserve1:             bigString(r[0].out["_reserve1"]),
+			BlockTimestampLast:   timestamp,
+			TotalSupply:          bigString(r[1].out["0"]),
+			KLast:                bigString(r[2].out["0"]),
+			Price0CumulativeLast: bigString(r[3].out["0"]),
+			Price1CumulativeLast: bigString(r[4].out["0"]),
+		}
+	}
+	return errs
+}
+
+// getV2PairState reads the state of a UniswapV2-like pair at the block
+func getV2PairState(ctx context.Context, provider contracts.Provider, pair *Pair, block uint64) (*PairState, error) {
+	pairContract := contracts.NewUniswapPair(web3.HexToAddress(pair.Address), provider)
+	at := web3.BlockNumber(block)
+	reserve0, reserve1, timestamp, err := pairContract.GetReserves(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	totalSupply, err := pairContract.TotalSupply(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	kLast, err := pairContract.KLast(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	price0CumulativeLast, err := pairContract.Price0CumulativeLast(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	price1CumulativeLast, err := pairContract.Price1CumulativeLast(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+	return &PairState{
+		Block:                block,
+		Reserve0:             reserve0.String(),
+		Reserve1:             reserve1.String(),
+		BlockTimestampLast:   timestamp,
+		TotalSupply:          totalSupply.String(),
+		KLast:                kLast.String(),
+		Price0CumulativeLast: price0CumulativeLast.String(),
+		Price1CumulativeLast: price1CumulativeLast.String(),
+	}, nil
+}
+
+func firstCallError(results []callResult) error {
+	for _, r := range results {
+		if r.err != nil {
+			return r.err
+		}
+	}
+	return nil
+}
+
+func bigString(v interface{}) string {
+	if n, ok := v.(*big.Int); ok {
+		return n.String()
+	}
+	return fmt.Sprint(v)
+}
@@ -1,87 +1,151 @@
 package dex
 
 import (
+	"context"
 	"fmt"
 	"github.com/nikolalosic/dex-pairs/contracts"
 	"github.com/umbracle/go-web3"
-	"github.com/umbracle/go-web3/contract/builtin/erc20"
-	"github.com/umbracle/go-web3/jsonrpc"
-	"log"
+	"golang.org/x/exp/slog"
 	"math/big"
 	"strings"
 )
 
 type PancakeSwap struct {
-	factory *contracts.PancakeFactory
-	client  *jsonrpc.Client
-	chainId int
+	factory  *contracts.PancakeFactory
+	provider contracts.Provider
+	chainId  int
+	batcher  callBatcher
+	block    web3.BlockNumber
+	tokens   *tokenCache
+	logger   *slog.Logger
 }
 
 // NewPancakeSwap creates a new instance of the PancakeSwap DEX
-func NewPancakeSwap(factoryAddress web3.Address, chainId int, nodeUrl string) (*PancakeSwap, error) {
-	client, err := jsonrpc.NewClient(nodeUrl)
-	if err != nil {
-		log.Printf("Error openning rpc client")
-		return nil, err
-	}
+func NewPancakeSwap(factoryAddress web3.Address, chainId int, provider contracts.Provider) (*PancakeSwap, error) {
 	return &PancakeSwap{
-		factory: contracts.NewPancakeFactory(factoryAddress, client),
-		client:  client,
-		chainId: chainId,
+		factory:  contracts.NewPancakeFactory(factoryAddress, provider),
+		provider: provider,
+		chainId:  chainId,
+		block:    web3.Latest,
+		tokens:   newTokenCache(),
+		logger:   slog.Default(),
 	}, nil
 }
 
-func (ps *PancakeSwap) GetPair(n int64) (*Pair, error) {
-	log.Printf("Getting PancakeSwap pair. n=%d", n)
+func (ps *PancakeSwap) GetPair(ctx context.Context, n int64) (*Pair, error) {
+	ps.logger.Debug("Getting PancakeSwap pair", "pairIndex", n)
 
-	pairAddress, err := ps.factory.AllPairs(n, web3.Latest)
+	pairAddress, err := ps.factory.AllPairs(ctx, n, ps.block)
 	if err != nil {
 		return nil, err
 	}
-	pairContract := contracts.NewUniswapPair(pairAddress, ps.client)
-	pairSymbol, _ := pairContract.Symbol(web3.Latest)
-	pairName, _ := pairContract.Name(web3.Latest)
-	pairDecimals, _ := pairContract.Decimals(web3.Latest)
-
-	token0, _ := pairContract.Token0(web3.Latest)
-	token1, _ := pairContract.Token1(web3.Latest)
-
-	token0Contract := erc20.NewERC20(token0, ps.client)
-	token1Contract := erc20.NewERC20(token1, ps.client)
-
-	token0Symbol := "UNK"
-	token1Symbol := "UNK"
-	if token0Contract.Contract().Addr() != zeroAddress {
-		token0Symbol, err = token0Contract.Symbol(web3.Latest)
-		if err != nil || !allowedRegex.MatchString(token0Symbol) {
-			token0Symbol = "UNK"
-		}
+	pairContract := contracts.NewUniswapPair(pairAddress, ps.provider)
+	pairSymbol, err := pairContract.Symbol(ctx, ps.block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
+	}
+	pairName, err := pairContract.Name(ctx, ps.block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
+	}
+	pairDecimals, err := pairContract.Decimals(ctx, ps.block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
+	}
+
+	token0, err := pairContract.Token0(ctx, ps.block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
 	}
-	if token1Contract.Contract().Addr() != zeroAddress {
-		token1Symbol, err = token1Contract.Symbol(web3.Latest)
-		if err != nil || !allowedRegex.MatchString(token1Symbol) {
-			token1Symbol = "UNK"
-		}
+	token1, err := pairContract.Token1(ctx, ps.block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
 	}
-	if len(token0Symbol) > 13 {
-		token0Symbol = token0Symbol[:13]
+
+	token0Info, err := ps.tokens.get(ctx, token0, ps.provider, ps.block)
+	if err != nil {
+		return nil, err
 	}
-	if len(token1Symbol) > 13 {
-		token0Symbol = token1Symbol[:13]
+	token1Info, err := ps.tokens.get(ctx, token1, ps.provider, ps.block)
+	if err != nil {
+		return nil, err
 	}
 
+	token0Symbol := ps.tokens.symbol(token0Info)
+	token1Symbol := ps.tokens.symbol(token1Info)
+
 	pair := Pair{
-		Token0:   strings.ToLower(token0.String()),
-		Token1:   strings.ToLower(token1.String()),
-		Name:     fmt.Sprintf("%s - %s/%s", pairName, token0Symbol, token1Symbol),
-		Address:  strings.ToLower(pairAddress.String()),
-		Symbol:   pairSymbol,
-		Decimals: int(pairDecimals),
-		ChainId:  ps.chainId,
+		Index:      n,
+		Token0:     strings.ToLower(token0.String()),
+		Token1:     strings.ToLower(token1.String()),
+		Token0Info: token0Info,
+		Token1Info: token1Info,
+		Name:       fmt.Sprintf("%s - %s/%s", pairName, token0Symbol, token1Symbol),
+		Address:    strings.ToLower(pairAddress.String()),
+		Symbol:     pairSymbol,
+		Decimals:   int(pairDecimals),
+		ChainId:    ps.chainId,
 	}
 	return &pair, nil
 }
 
-func (ps *PancakeSwap) GetPairNumber() (*big.Int, error) {
-	return ps.factory.AllPairsLength(web3.Latest)
+func (ps *PancakeSwap) GetPairNumber(ctx context.Context) (*big.Int, error) {
+	return ps.factory.AllPairsLength(ctx, ps.block)
+}
+
+// EnableMulticall makes GetPairs batch its calls through the Multicall3 contract at the given address
+func (ps *PancakeSwap) EnableMulticall(address web3.Address, batchSize int) {
+	ps.batcher = NewMulticall(address, ps.provider, batchSize)
+}
+
+// EnableBatchTransport makes GetPairs send its calls as JSON-RPC batches
+func (ps *PancakeSwap) EnableBatchTransport(batchSize int) {
+	bt := NewBatchTransport(ps.provider, batchSize)
+	bt.SetLogger(ps.logger)
+	ps.batcher = bt
+}
+
+// GetPairs returns pairs in the [start, end) range, with errors reported per pair
+func (ps *PancakeSwap) GetPairs(ctx context.Context, start int64, end int64) ([]*Pair, []error) {
+	if ps.batcher == nil {
+		return getPairsOneByOne(ctx, ps, start, end)
+	}
+	ps.logger.Debug("Getting pairs in batch", "start", start, "end", end)
+	return getV2Pairs(ctx, ps.batcher, ps.tokens, ps.factory.Contract(), start, end, ps.chainId, ps.block)
+}
+
+// GetPairStates sets the state of every pair at the block
+func (ps *PancakeSwap) GetPairStates(ctx context.Context, pairs []*Pair, block uint64) []error {
+	if ps.batcher != nil {
+		ps.logger.Debug("Getting pair states in batch", "pairs", len(pairs), "block", block)
+	}
+	return getV2PairStates(ctx, ps.batcher, ps.provider, pairs, block)
+}
+
+// SetBlock pins every call to the block
+func (ps *PancakeSwap) SetBlock(block web3.BlockNumber) {
+	ps.block = block
+}
+
+// SetSanitizePolicy sets the policy token symbols and names are sanitized with
+func (ps *PancakeSwap) SetSanitizePolicy(policy SanitizePolicy) {
+	ps.tokens.policy = policy
+}
+
+// SetLogger sets the logger of the exchange
+func (ps *PancakeSwap) SetLogger(logger *slog.Logger) {
+	ps.logger = logger
+	if bt, ok := ps.batcher.(*BatchTransport); ok {
+		bt.SetLogger(logger)
+	}
+}
+
+// PairCreatedFilter returns the factory address and the PairCreated topic
+func (ps *PancakeSwap) PairCreatedFilter() (web3.Address, web3.Hash) {
+	return ps.factory.Contract().Addr(), ps.factory.PairCreatedEventSig()
+}
+
+// ParsePairCreated decodes a PairCreated log of the factory
+func (ps *PancakeSwap) ParsePairCreated(log *web3.Log) (*contracts.PairCreatedEvent, error) {
+	return ps.factory.ParsePairCreated(log)
 }
@@ -0,0 +1,164 @@
+package dex
+
+import (
+	"context"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"golang.org/x/exp/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// minAdaptiveRate is the lowest rate the adaptive limiter backs off to
+	minAdaptiveRate = 1
+	// adaptiveDecreaseInterval is the minimum time between two rate decreases, so a burst of throttled
+	// in-flight requests halves the rate only once
+	adaptiveDecreaseInterval = time.Second
+)
+
+// RateLimiter is a token bucket limiting requests per second, shared by every worker using the provider.
+// In adaptive mode the rate is halved whenever the node throttles requests and is increased
+// step by step back to the configured rate while requests succeed (AIMD).
+type RateLimiter struct {
+	m            sync.Mutex
+	rate         float64
+	maxRate      float64
+	tokens       float64
+	last         time.Time
+	adaptive     bool
+	lastDecrease time.Time
+	logger       *slog.Logger
+}
+
+// NewRateLimiter creates a new RateLimiter allowing rps requests per second
+func NewRateLimiter(rps float64, adaptive bool) *RateLimiter {
+	return &RateLimiter{
+		rate:     rps,
+		maxRate:  rps,
+		tokens:   rps,
+		last:     time.Now(),
+		adaptive: adaptive,
+		logger:   slog.Default(),
+	}
+}
+
+// SetLogger sets the logger of the limiter, which defaults to slog.Default
+func (rl *RateLimiter) SetLogger(logger *slog.Logger) {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+	rl.logger = logger
+}
+
+// Wait blocks until n requests can be sent or the context is done
+func (rl *RateLimiter) Wait(ctx context.Context, n int) error {
+	for {
+		rl.m.Lock()
+		now := time.Now()
+		rl.tokens += now.Sub(rl.last).Seconds() * rl.rate
+		if rl.tokens > rl.rate {
+			rl.tokens = rl.rate
+		}
+		rl.last = now
+		// requests larger than the bucket are let through once the bucket is full
+		if rl.tokens >= float64(n) || rl.tokens >= rl.rate {
+			rl.tokens -= float64(n)
+			rl.m.Unlock()
+			return nil
+		}
+		missing := float64(n) - rl.tokens
+		if missing > rl.rate {
+			missing = rl.rate - rl.tokens
+		}
+		wait := time.Duration(missing / rl.rate * float64(time.Second))
+		rl.m.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Rate returns the current number of requests per second
+func (rl *RateLimiter) Rate() float64 {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+	return rl.rate
+}
+
+// onSuccess increases the rate of an adaptive limiter, by about one request per second for every second
+// of successful requests
+func (rl *RateLimiter) onSuccess() {
+	if !rl.adaptive {
+		return
+	}
+	rl.m.Lock()
+	defer rl.m.Unlock()
+	if rl.rate < rl.maxRate {
+		rl.rate += 1 / rl.rate
+		if rl.rate > rl.maxRate {
+			rl.rate = rl.maxRate
+		}
+	}
+}
+
+// onThrottled halves the rate of an adaptive limiter
+func (rl *RateLimiter) onThrottled() {
+	if !rl.adaptive {
+		return
+	}
+	rl.m.Lock()
+	defer rl.m.Unlock()
+	if time.Since(rl.lastDecrease) < adaptiveDecreaseInterval {
+		return
+	}
+	rl.lastDecrease = time.Now()
+	rl.rate /= 2
+	if rl.rate < minAdaptiveRate {
+		rl.rate = minAdaptiveRate
+	}
+	if rl.tokens > rl.rate {
+		rl.tokens = rl.rate
+	}
+	rl.logger.Warn("Node is throttling requests, lowering rate", "rps", rl.rate)
+}
+
+// observe updates an adaptive limiter with the outcome of a request
+func (rl *RateLimiter) observe(err error) {
+	if err != nil && ClassifyError(err) == ErrorClassRateLimited {
+		rl.onThrottled()
+	} else if err == nil {
+		rl.onSuccess()
+	}
+}
+
+// rateLimitedProvider waits for the limiter before every call of the wrapped provider
+type rateLimitedProvider struct {
+	provider contracts.Provider
+	limiter  *RateLimiter
+}
+
+// Call makes a jsonrpc call
+func (rp *rateLimitedProvider) Call(ctx context.Context, method string, out interface{}, params ...interface{}) error {
+	if err := rp.limiter.Wait(ctx, 1); err != nil {
+		return err
+	}
+	err := rp.provider.Call(ctx, method, out, params...)
+	rp.limiter.observe(err)
+	return err
+}
+
+func (rp *rateLimitedProvider) batchCall(ctx context.Context, requests []rpcRequest) (map[uint64]*rpcResponse, error) {
+	bp, ok := rp.provider.(batchProvider)
+	if !ok {
+		return nil, errBatchUnsupported
+	}
+	if err := rp.limiter.Wait(ctx, len(requests)); err != nil {
+		return nil, err
+	}
+	responses, err := bp.batchCall(ctx, requests)
+	rp.limiter.observe(err)
+	return responses, err
+}
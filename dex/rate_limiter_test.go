@@ -0,0 +1,103 @@
+package dex
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	rl := NewRateLimiter(50, false)
+	ctx := context.Background()
+
+	// the bucket starts full
+	start := time.Now()
+	if err := rl.Wait(ctx, 50); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("expected a full bucket, waited %s", elapsed)
+	}
+
+	// 10 more requests take 200ms at 50 requests per second
+	start = time.Now()
+	if err := rl.Wait(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected to wait for the bucket to refill, waited %s", elapsed)
+	}
+}
+
+func TestRateLimiterWaitLargerThanBucket(t *testing.T) {
+	rl := NewRateLimiter(10, false)
+	// a batch larger than the bucket is let through once the bucket is full
+	if err := rl.Wait(context.Background(), 25); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	rl := NewRateLimiter(1, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := rl.Wait(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.Wait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRateLimiterAdaptive(t *testing.T) {
+	rl := NewRateLimiter(40, true)
+	throttled := &httpStatusError{StatusCode: http.StatusTooManyRequests}
+	rl.SetLogger(testLogger)
+
+	// a burst of throttled requests halves the rate once
+	rl.observe(throttled)
+	rl.observe(throttled)
+	if rate := rl.Rate(); rate != 20 {
+		t.Fatalf("expected rate 20, got %v", rate)
+	}
+
+	// other errors leave the rate alone
+	rl.observe(&httpStatusError{StatusCode: http.StatusServiceUnavailable})
+	if rate := rl.Rate(); rate != 20 {
+		t.Fatalf("expected rate 20, got %v", rate)
+	}
+
+	// the rate grows by one request per second for every second of successful requests
+	for i := 0; i < 20; i++ {
+		rl.observe(nil)
+	}
+	if rate := rl.Rate(); rate <= 20 || rate > 21 {
+		t.Errorf("expected rate between 20 and 21, got %v", rate)
+	}
+	for i := 0; i < 10000; i++ {
+		rl.observe(nil)
+	}
+	if rate := rl.Rate(); rate != 40 {
+		t.Errorf("expected rate back at 40, got %v", rate)
+	}
+
+	// the rate is halved again once the decrease interval passed, down to the minimum
+	rl.m.Lock()
+	rl.rate = 1.5
+	rl.lastDecrease = time.Now().Add(-adaptiveDecreaseInterval)
+	rl.m.Unlock()
+	rl.observe(throttled)
+	if rate := rl.Rate(); rate != minAdaptiveRate {
+		t.Errorf("expected rate %v, got %v", float64(minAdaptiveRate), rate)
+	}
+}
+
+func TestRateLimiterNotAdaptive(t *testing.T) {
+	rl := NewRateLimiter(40, false)
+	rl.observe(&httpStatusError{StatusCode: http.StatusTooManyRequests})
+	if rate := rl.Rate(); rate != 40 {
+		t.Errorf("expected rate 40, got %v", rate)
+	}
+}
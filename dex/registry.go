@@ -0,0 +1,192 @@
+package dex
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Protocol families of the built-in DEX implementations
+const (
+	ProtocolUniswapV1   = "univ1"
+	ProtocolUniswapV2   = "univ2"
+	ProtocolUniswapV3   = "univ3"
+	ProtocolPancakeSwap = "pancakeswap"
+)
+
+// Constructor creates a DexExchange for the factory deployed on the chain.
+// startBlock is the block the factory was deployed at, used by implementations scanning logs.
+type Constructor func(
+	factory web3.Address, chainId int, provider contracts.Provider, startBlock uint64,
+) (DexExchange, error)
+
+var protocolsLock sync.RWMutex
+var protocols = map[string]Constructor{}
+
+// RegisterProtocol registers the implementation of a protocol family, replacing any previous one
+func RegisterProtocol(protocol string, constructor Constructor) {
+	protocolsLock.Lock()
+	defer protocolsLock.Unlock()
+	protocols[protocol] = constructor
+}
+
+func getProtocol(protocol string) (Constructor, bool) {
+	protocolsLock.RLock()
+	defer protocolsLock.RUnlock()
+	constructor, ok := protocols[protocol]
+	return constructor, ok
+}
+
+func init() {
+	RegisterProtocol(ProtocolUniswapV1, func(factory web3.Address, chainId int, provider contracts.Provider, _ uint64) (DexExchange, error) {
+		return NewUniswapV1(factory, chainId, provider)
+	})
+	RegisterProtocol(ProtocolUniswapV2, func(factory web3.Address, chainId int, provider contracts.Provider, _ uint64) (DexExchange, error) {
+		return NewUniswap(factory, chainId, provider)
+	})
+	RegisterProtocol(ProtocolUniswapV3, func(factory web3.Address, chainId int, provider contracts.Provider, startBlock uint64) (DexExchange, error) {
+		return NewUniswapV3(factory, chainId, provider, startBlock)
+	})
+	RegisterProtocol(ProtocolPancakeSwap, func(factory web3.Address, chainId int, provider contracts.Provider, _ uint64) (DexExchange, error) {
+		return NewPancakeSwap(factory, chainId, provider)
+	})
+}
+
+// Deployment is a DEX factory deployed on a chain
+type Deployment struct {
+	Name       string       `json:"name" yaml:"name"`
+	ChainId    int          `json:"chainId" yaml:"chainId"`
+	Version    int          `json:"version" yaml:"version"`
+	Factory    web3.Address `json:"factory" yaml:"factory"`
+	Protocol   string       `json:"protocol" yaml:"protocol"`
+	StartBlock uint64       `json:"startBlock,omitempty" yaml:"startBlock,omitempty"`
+}
+
+type deploymentKey struct {
+	name    string
+	chainId int
+	version int
+}
+
+// defaultDeployments are the DEX factories known without a config file
+var defaultDeployments = []Deployment{
+	{
+		Name: "uniswap", ChainId: 1, Version: 1, Protocol: ProtocolUniswapV1,
+		Factory: web3.HexToAddress("0xc0a47dfe034b400b47bdad5fecda2621de6c4d95"),
+	},
+	{
+		Name: "uniswap", ChainId: 1, Version: 2, Protocol: ProtocolUniswapV2,
+		Factory: web3.HexToAddress("0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f"),
+	},
+	{
+		Name: "uniswap", ChainId: 1, Version: 3, Protocol: ProtocolUniswapV3,
+		Factory: web3.HexToAddress("0x1f98431c8ad98523631ae4a59f267346ea31f984"), StartBlock: 12369621,
+	},
+	{
+		Name: "pancakeswap", ChainId: 56, Version: 1, Protocol: ProtocolPancakeSwap,
+		Factory: web3.HexToAddress("0xbcfccbde45ce874adcb698cc183debcf17952812"),
+	},
+	{
+		Name: "pancakeswap", ChainId: 56, Version: 2, Protocol: ProtocolPancakeSwap,
+		Factory: web3.HexToAddress("0xca143ce32fe78f1f7019d7d551a6402fc5350c73"),
+	},
+}
+
+// Registry holds DEX deployments by name, chain id and version
+type Registry struct {
+	deployments map[deploymentKey]Deployment
+}
+
+// NewRegistry creates a new Registry holding the built-in deployments
+func NewRegistry() *Registry {
+	r := &Registry{deployments: map[deploymentKey]Deployment{}}
+	for _, d := range defaultDeployments {
+		r.deployments[keyOf(d)] = d
+	}
+	return r
+}
+
+func keyOf(d Deployment) deploymentKey {
+	return deploymentKey{name: strings.ToLower(d.Name), chainId: d.ChainId, version: d.Version}
+}
+
+// Add adds the deployment, replacing a deployment with the same name, chain id and version
+func (r *Registry) Add(d Deployment) error {
+	if d.Name == "" {
+		return fmt.Errorf("deployment of factory %s has no name", d.Factory)
+	}
+	if d.Factory == zeroAddress {
+		return fmt.Errorf("deployment %s has no factory address", d.Name)
+	}
+	if _, ok := getProtocol(d.Protocol); !ok {
+		return fmt.Errorf("deployment %s has unknown protocol %q", d.Name, d.Protocol)
+	}
+	r.deployments[keyOf(d)] = d
+	return nil
+}
+
+// LoadFile adds deployments listed in a YAML (.yaml, .yml) or JSON file
+func (r *Registry) LoadFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var deployments []Deployment
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &deployments)
+	default:
+		err = json.Unmarshal(content, &deployments)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, d := range deployments {
+		if err := r.Add(d); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Get returns the deployment of the DEX version on the chain
+func (r *Registry) Get(name string, chainId int, version int) (Deployment, bool) {
+	d, ok := r.deployments[deploymentKey{name: strings.ToLower(name), chainId: chainId, version: version}]
+	return d, ok
+}
+
+// Deployments returns all deployments sorted by name, chain id and version
+func (r *Registry) Deployments() []Deployment {
+	deployments := make([]Deployment, 0, len(r.deployments))
+	for _, d := range r.deployments {
+		deployments = append(deployments, d)
+	}
+	sort.Slice(deployments, func(i, j int) bool {
+		a, b := keyOf(deployments[i]), keyOf(deployments[j])
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if a.chainId != b.chainId {
+			return a.chainId < b.chainId
+		}
+		return a.version < b.version
+	})
+	return deployments
+}
+
+// NewDex creates the DexExchange of the DEX version on the chain
+func (r *Registry) NewDex(name string, chainId int, version int, provider contracts.Provider) (DexExchange, error) {
+	d, ok := r.Get(name, chainId, version)
+	if !ok {
+		return nil, fmt.Errorf("no %s V%d deployment on chain %d", name, version, chainId)
+	}
+	constructor, _ := getProtocol(d.Protocol)
+	return constructor(d.Factory, d.ChainId, provider, d.StartBlock)
+}
@@ -0,0 +1,176 @@
+package dex
+
+import (
+	"context"
+	"errors"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3/jsonrpc/codec"
+	"golang.org/x/exp/slog"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrorClass tells whether a failed call is worth retrying
+type ErrorClass int
+
+const (
+	// ErrorClassPermanent errors fail the same way on every attempt, e.g. execution reverted or bad ABI
+	ErrorClassPermanent ErrorClass = iota
+	// ErrorClassRetryable errors are transient, e.g. timeouts and connection resets
+	ErrorClassRetryable
+	// ErrorClassRateLimited errors are returned by nodes throttling requests
+	ErrorClassRateLimited
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassRetryable:
+		return "retryable"
+	case ErrorClassRateLimited:
+		return "rate_limited"
+	}
+	return "permanent"
+}
+
+// ClassifyError returns the class of an error returned by a contract call
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassPermanent
+	}
+
+	// calls cancelled by the caller are not retried, while calls running out of their own time are
+	if errors.Is(err, context.Canceled) {
+		return ErrorClassPermanent
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassRetryable
+	}
+	if errors.Is(err, errMissingResponse) {
+		return ErrorClassRetryable
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode == http.StatusTooManyRequests {
+			return ErrorClassRateLimited
+		}
+		if statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusRequestTimeout {
+			return ErrorClassRetryable
+		}
+		return ErrorClassPermanent
+	}
+
+	code := 0
+	var rpcErr *rpcError
+	var codecErr *codec.ErrorObject
+	if errors.As(err, &rpcErr) {
+		code = rpcErr.Code
+	} else if errors.As(err, &codecErr) {
+		code = codecErr.Code
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case code == -32005 || strings.Contains(msg, "rate limit") || strings.Contains(msg, "too many requests"):
+		return ErrorClassRateLimited
+	case strings.Contains(msg, "revert"):
+		return ErrorClassPermanent
+	case code == -32603 || strings.Contains(msg, "timeout") || strings.Contains(msg, "header not found"):
+		return ErrorClassRetryable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(msg, "connection reset") || strings.Contains(msg, "connection refused") {
+		return ErrorClassRetryable
+	}
+	return ErrorClassPermanent
+}
+
+// RetryPolicy retries retryable and rate limited calls with exponential backoff and jitter
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+	}
+}
+
+// backoff returns the delay before the given retry attempt, randomized between half and the full delay
+func (rp RetryPolicy) backoff(attempt int) time.Duration {
+	delay := rp.BaseDelay << uint(attempt)
+	if delay > rp.MaxDelay || delay <= 0 {
+		delay = rp.MaxDelay
+	}
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// do calls fn until it succeeds, fails with a permanent error, runs out of attempts or the context is done
+func (rp RetryPolicy) do(ctx context.Context, logger *slog.Logger, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		class := ClassifyError(err)
+		if class == ErrorClassPermanent || attempt+1 >= rp.MaxAttempts {
+			return err
+		}
+
+		delay := rp.backoff(attempt)
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			delay = statusErr.RetryAfter
+		}
+		logger.Warn("Retrying call", "class", class.String(), "delay", delay, "attempt", attempt+1, "error", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// retryProvider retries calls of the wrapped provider according to the policy
+type retryProvider struct {
+	provider contracts.Provider
+	policy   RetryPolicy
+	logger   *slog.Logger
+}
+
+// Call makes a jsonrpc call
+func (rp *retryProvider) Call(ctx context.Context, method string, out interface{}, params ...interface{}) error {
+	return rp.policy.do(ctx, rp.logger, func() error {
+		return rp.provider.Call(ctx, method, out, params...)
+	})
+}
+
+func (rp *retryProvider) batchCall(ctx context.Context, requests []rpcRequest) (map[uint64]*rpcResponse, error) {
+	bp, ok := rp.provider.(batchProvider)
+	if !ok {
+		return nil, errBatchUnsupported
+	}
+	var responses map[uint64]*rpcResponse
+	err := rp.policy.do(ctx, rp.logger, func() error {
+		var err error
+		responses, err = bp.batchCall(ctx, requests)
+		return err
+	})
+	return responses, err
+}
@@ -0,0 +1,135 @@
+package dex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/exp/slog"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRetryPolicy retries without noticeable delay
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+// testLogger drops the warnings of expected retries
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err   error
+		class ErrorClass
+	}{
+		{&httpStatusError{StatusCode: http.StatusTooManyRequests}, ErrorClassRateLimited},
+		{&httpStatusError{StatusCode: http.StatusServiceUnavailable}, ErrorClassRetryable},
+		{&httpStatusError{StatusCode: http.StatusRequestTimeout}, ErrorClassRetryable},
+		{&httpStatusError{StatusCode: http.StatusBadRequest}, ErrorClassPermanent},
+		{&rpcError{Code: -32005, Message: "limit exceeded"}, ErrorClassRateLimited},
+		{&rpcError{Code: -32000, Message: "daily request count exceeded, request rate limited"}, ErrorClassRateLimited},
+		{&rpcError{Code: 3, Message: "execution reverted"}, ErrorClassPermanent},
+		{&rpcError{Code: -32000, Message: "header not found"}, ErrorClassRetryable},
+		{&rpcError{Code: -32603, Message: "internal error"}, ErrorClassRetryable},
+		{&rpcError{Code: -32602, Message: "invalid argument"}, ErrorClassPermanent},
+		{fmt.Errorf("call: %w", context.DeadlineExceeded), ErrorClassRetryable},
+		{fmt.Errorf("call: %w", context.Canceled), ErrorClassPermanent},
+		{fmt.Errorf("%w for call symbol", errMissingResponse), ErrorClassRetryable},
+		{fmt.Errorf("read: %w", io.EOF), ErrorClassRetryable},
+		{errors.New("read tcp: connection reset by peer"), ErrorClassRetryable},
+		{errors.New("abi: cannot unmarshal"), ErrorClassPermanent},
+	}
+	for _, tt := range tests {
+		if class := ClassifyError(tt.err); class != tt.class {
+			t.Errorf("%v: expected %s, got %s", tt.err, tt.class, class)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	ctx := context.Background()
+	retryable := &httpStatusError{StatusCode: http.StatusServiceUnavailable}
+
+	calls := 0
+	err := testRetryPolicy.do(ctx, testLogger, func() error {
+		calls++
+		if calls < 3 {
+			return retryable
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success after 3 calls, got %v after %d", err, calls)
+	}
+
+	calls = 0
+	err = testRetryPolicy.do(ctx, testLogger, func() error {
+		calls++
+		return &rpcError{Code: 3, Message: "execution reverted"}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected permanent error after 1 call, got %v after %d", err, calls)
+	}
+
+	calls = 0
+	err = testRetryPolicy.do(ctx, testLogger, func() error {
+		calls++
+		return retryable
+	})
+	if !errors.Is(err, retryable) || calls != testRetryPolicy.MaxAttempts {
+		t.Errorf("expected last error after %d calls, got %v after %d", testRetryPolicy.MaxAttempts, err, calls)
+	}
+}
+
+func TestRetryPolicyDoStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	calls := 0
+	err := policy.do(ctx, testLogger, func() error {
+		calls++
+		// the backoff of an hour is cut short
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return &httpStatusError{StatusCode: http.StatusServiceUnavailable}
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("expected cancellation after 1 call, got %v after %d", err, calls)
+	}
+}
+
+func TestProviderRetriesFailedCalls(t *testing.T) {
+	var m sync.Mutex
+	failures := 2
+	node := newTestNode(t, map[string]rpcHandler{
+		"eth_blockNumber": func(params []json.RawMessage) (interface{}, error) {
+			m.Lock()
+			defer m.Unlock()
+			if failures > 0 {
+				failures--
+				return nil, &httpStatusError{StatusCode: http.StatusServiceUnavailable, Body: "unavailable"}
+			}
+			return "0x100", nil
+		},
+	})
+	provider, err := NewProvider(ProviderConfig{
+		Endpoints: []Endpoint{{URL: node.URL}},
+		Strategy:  RoundRobin,
+		Retry:     testRetryPolicy,
+		Logger:    testLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := GetBlockNumber(context.Background(), provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block != 256 {
+		t.Errorf("expected block 256, got %d", block)
+	}
+	if n := node.count("eth_blockNumber"); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
@@ -0,0 +1,108 @@
+package dex
+
+import (
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"regexp"
+	"strings"
+)
+
+// Unicode normalization forms applied by a SanitizePolicy
+const (
+	NormalizationNone = ""
+	NormalizationNFC  = "nfc"
+	NormalizationNFKC = "nfkc"
+)
+
+// SanitizePolicy decides how token symbols and names read from chain are cleaned up before they are
+// exported. The raw on-chain values are kept in the RawSymbol and RawName fields of the token.
+type SanitizePolicy struct {
+	// Charset matches a single allowed character, nil allows every character
+	Charset *regexp.Regexp
+	// Strip removes characters outside of Charset, otherwise the whole value is replaced
+	Strip bool
+	// MaxSymbolLength and MaxNameLength are maximum numbers of characters, 0 means no limit
+	MaxSymbolLength int
+	MaxNameLength   int
+	// Replacement is used for values which are empty or not allowed
+	Replacement string
+	// Normalization is the unicode normalization form applied before the charset is checked
+	Normalization string
+}
+
+// SanitizePolicies are the predefined policies selectable by name
+var SanitizePolicies = map[string]SanitizePolicy{
+	// strict is the original policy: ASCII words and a few symbols, and short symbols
+	"strict": {
+		Charset:         regexp.MustCompile(`[ \w.'+\-$%/]`),
+		MaxSymbolLength: 13,
+		Replacement:     "UNK",
+	},
+	// ui strips emoji and other symbols, but keeps letters and digits of any script
+	"ui": {
+		Charset:         regexp.MustCompile(`[\p{L}\p{N} .'+\-$%/]`),
+		Strip:           true,
+		MaxSymbolLength: 13,
+		MaxNameLength:   60,
+		Replacement:     "UNK",
+		Normalization:   NormalizationNFKC,
+	},
+	// raw keeps values as they are read from chain
+	"raw": {
+		Replacement: "UNK",
+	},
+}
+
+// DefaultSanitizePolicy is the policy used unless another one is set
+var DefaultSanitizePolicy = SanitizePolicies["strict"]
+
+// ParseNormalization validates a unicode normalization form name
+func ParseNormalization(form string) (string, error) {
+	switch strings.ToLower(form) {
+	case NormalizationNone, "none":
+		return NormalizationNone, nil
+	case NormalizationNFC:
+		return NormalizationNFC, nil
+	case NormalizationNFKC:
+		return NormalizationNFKC, nil
+	}
+	return "", fmt.Errorf("unknown unicode normalization %s", form)
+}
+
+// Symbol sanitizes a token symbol
+func (p SanitizePolicy) Symbol(value string) string {
+	return p.sanitize(value, p.MaxSymbolLength)
+}
+
+// Name sanitizes a token name
+func (p SanitizePolicy) Name(value string) string {
+	return p.sanitize(value, p.MaxNameLength)
+}
+
+func (p SanitizePolicy) sanitize(value string, maxLength int) string {
+	switch p.Normalization {
+	case NormalizationNFC:
+		value = norm.NFC.String(value)
+	case NormalizationNFKC:
+		value = norm.NFKC.String(value)
+	}
+	if p.Charset != nil {
+		var b strings.Builder
+		for _, c := range value {
+			if p.Charset.MatchString(string(c)) {
+				b.WriteRune(c)
+			} else if !p.Strip {
+				return p.Replacement
+			}
+		}
+		value = b.String()
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return p.Replacement
+	}
+	if runes := []rune(value); maxLength > 0 && len(runes) > maxLength {
+		value = string(runes[:maxLength])
+	}
+	return value
+}
@@ -0,0 +1,123 @@
+package dex
+
+import (
+	"context"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"github.com/umbracle/go-web3/contract/builtin/erc20"
+	"math/big"
+	"regexp"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizePolicy(t *testing.T) {
+	nfc := SanitizePolicy{MaxSymbolLength: 1, Replacement: "UNK", Normalization: NormalizationNFC}
+	tests := []struct {
+		name   string
+		policy SanitizePolicy
+		// symbol selects Symbol, otherwise Name is sanitized
+		symbol bool
+		value  string
+		want   string
+	}{
+		{name: "strict keeps ascii", policy: SanitizePolicies["strict"], symbol: true, value: "WETH", want: "WETH"},
+		{name: "strict trims spaces", policy: SanitizePolicies["strict"], symbol: true, value: " DAI ", want: "DAI"},
+		{name: "strict replaces empty", policy: SanitizePolicies["strict"], symbol: true, value: "  ", want: "UNK"},
+		{name: "strict replaces emoji", policy: SanitizePolicies["strict"], symbol: true, value: "🦄UNI", want: "UNK"},
+		{
+			name: "strict truncates symbol", policy: SanitizePolicies["strict"], symbol: true,
+			value: "ABCDEFGHIJKLMNOP", want: "ABCDEFGHIJKLM",
+		},
+		{
+			name: "strict keeps long name", policy: SanitizePolicies["strict"],
+			value: "A name longer than any symbol", want: "A name longer than any symbol",
+		},
+		{name: "ui strips emoji", policy: SanitizePolicies["ui"], symbol: true, value: "🦄 UNI", want: "UNI"},
+		{name: "ui replaces only emoji", policy: SanitizePolicies["ui"], symbol: true, value: "🚀🚀", want: "UNK"},
+		{name: "ui keeps other scripts", policy: SanitizePolicies["ui"], symbol: true, value: "日本円", want: "日本円"},
+		{
+			name: "ui truncates runes", policy: SanitizePolicies["ui"], symbol: true,
+			value: "ÄÖÜÄÖÜÄÖÜÄÖÜÄÖÜ", want: "ÄÖÜÄÖÜÄÖÜÄÖÜÄ",
+		},
+		{name: "ui applies nfkc", policy: SanitizePolicies["ui"], symbol: true, value: "ＵＳＤＴ", want: "USDT"},
+		{name: "ui applies nfkc to ligatures", policy: SanitizePolicies["ui"], value: "ﬁnance", want: "finance"},
+		{name: "raw keeps emoji", policy: SanitizePolicies["raw"], symbol: true, value: "🦄 UNI", want: "🦄 UNI"},
+		{
+			name: "raw keeps long symbol", policy: SanitizePolicies["raw"], symbol: true,
+			value: "ABCDEFGHIJKLMNOP", want: "ABCDEFGHIJKLMNOP",
+		},
+		{name: "raw replaces empty", policy: SanitizePolicies["raw"], symbol: true, value: "", want: "UNK"},
+		{name: "nfc composes before truncating", policy: nfc, symbol: true, value: "éx", want: "é"},
+		{
+			name: "strip removes characters", symbol: true, value: "A-B*C",
+			policy: SanitizePolicy{Charset: regexp.MustCompile(`[A-Z]`), Strip: true, Replacement: "UNK"},
+			want:   "ABC",
+		},
+		{
+			name: "replace drops value", symbol: true, value: "A-B*C",
+			policy: SanitizePolicy{Charset: regexp.MustCompile(`[A-Z]`), Replacement: "UNK"},
+			want:   "UNK",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.Name(tt.value)
+			if tt.symbol {
+				got = tt.policy.Symbol(tt.value)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("invalid UTF-8 %q", got)
+			}
+		})
+	}
+}
+
+func TestParseNormalization(t *testing.T) {
+	forms := map[string]string{"": NormalizationNone, "none": NormalizationNone, "NFKC": NormalizationNFKC}
+	for form, want := range forms {
+		if got, err := ParseNormalization(form); err != nil || got != want {
+			t.Errorf("%q: expected %q, got %q, %v", form, want, got, err)
+		}
+	}
+	if _, err := ParseNormalization("nfd"); err == nil {
+		t.Error("expected error of an unknown normalization")
+	}
+}
+
+// TestUniswapPairNameSymbols checks every token of a pair name is truncated on its own
+func TestUniswapPairNameSymbols(t *testing.T) {
+	long := web3.HexToAddress("0x00000000000000000000000000000000000000aa")
+	calls := map[web3.Address]testContract{
+		testFactory: {abi: contracts.UniswapFactoryAbi(), outputs: map[string]interface{}{"allPairs": testPair}},
+		testPair: {abi: contracts.UniswapPairAbi(), outputs: map[string]interface{}{
+			"symbol": "UNI-V2", "name": "Uniswap V2", "decimals": uint8(18), "token0": long, "token1": testWETH,
+		}},
+		long: {abi: erc20.ERC20Abi(), outputs: map[string]interface{}{
+			"symbol": "LONGSYMBOLOFTOKEN", "name": "Long", "decimals": uint8(18), "totalSupply": big.NewInt(1),
+		}},
+		testWETH: {abi: erc20.ERC20Abi(), outputs: map[string]interface{}{
+			"symbol": "WETH", "name": "Wrapped Ether", "decimals": uint8(18), "totalSupply": big.NewInt(1),
+		}},
+	}
+	node := newTestNode(t, map[string]rpcHandler{"eth_call": contractCalls(calls)})
+	us, err := NewUniswap(testFactory, 1, NewHTTPTransport(node.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	us.SetLogger(testLogger)
+
+	pair, err := us.GetPair(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair.Name != "Uniswap V2 - LONGSYMBOLOFT/WETH" {
+		t.Errorf("unexpected pair name %s", pair.Name)
+	}
+	if pair.Token0Info.Symbol != "LONGSYMBOLOFT" || pair.Token1Info.Symbol != "WETH" {
+		t.Errorf("unexpected symbols %s and %s", pair.Token0Info.Symbol, pair.Token1Info.Symbol)
+	}
+}
@@ -0,0 +1,147 @@
+package dex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/umbracle/go-web3"
+	"sync"
+	"time"
+)
+
+const (
+	// wsPingInterval is how often the websocket connection is pinged
+	wsPingInterval = 20 * time.Second
+	// wsReadTimeout is how long the connection may stay silent, pongs included, before it is considered dropped
+	wsReadTimeout = 3 * wsPingInterval
+)
+
+type subscriptionMessage struct {
+	Method string `json:"method"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+// logSubscription receives logs matching a filter through eth_subscribe over a websocket connection.
+// The go-web3 websocket client neither sends subscription params nor reports dropped connections,
+// so the connection is handled here. Logs is closed when the connection drops, Err returns the reason.
+type logSubscription struct {
+	conn *websocket.Conn
+	id   string
+	logs chan *web3.Log
+	done chan struct{}
+	once sync.Once
+	err  error
+}
+
+// subscribeLogs subscribes to logs of the address with the topic. The context bounds connecting only,
+// the subscription lasts until it is closed.
+func subscribeLogs(ctx context.Context, url string, address web3.Address, topic web3.Hash) (*logSubscription, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, redactURL(err)
+	}
+	filter := map[string]interface{}{
+		"address": address.String(),
+		"topics":  []string{topic.String()},
+	}
+	request := rpcRequest{JsonRPC: "2.0", ID: 1, Method: "eth_subscribe", Params: []interface{}{"logs", filter}}
+	conn.SetWriteDeadline(time.Now().Add(wsReadTimeout))
+	if err := conn.WriteJSON(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	var response rpcResponse
+	if err := conn.ReadJSON(&response); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if response.Error != nil {
+		conn.Close()
+		return nil, response.Error
+	}
+	s := &logSubscription{
+		conn: conn,
+		logs: make(chan *web3.Log),
+		done: make(chan struct{}),
+	}
+	if err := json.Unmarshal(response.Result, &s.id); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("invalid subscription id %s", string(response.Result))
+	}
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+	})
+	go s.read()
+	go s.ping()
+	return s, nil
+}
+
+// Logs returns the channel logs are received on
+func (s *logSubscription) Logs() <-chan *web3.Log {
+	return s.logs
+}
+
+// Err returns the reason the subscription ended, once Logs is closed
+func (s *logSubscription) Err() error {
+	return s.err
+}
+
+// Close closes the connection
+func (s *logSubscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.conn.Close()
+	})
+}
+
+func (s *logSubscription) read() {
+	defer close(s.logs)
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			s.err = err
+			return
+		}
+		s.conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		var msg subscriptionMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.err = err
+			return
+		}
+		if msg.Method != "eth_subscription" || msg.Params.Subscription != s.id {
+			continue
+		}
+		l := new(web3.Log)
+		if err := json.Unmarshal(msg.Params.Result, l); err != nil {
+			s.err = err
+			return
+		}
+		select {
+		case s.logs <- l:
+		case <-s.done:
+			s.err = fmt.Errorf("subscription closed")
+			return
+		}
+	}
+}
+
+func (s *logSubscription) ping() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsPingInterval)); err != nil {
+				s.conn.Close()
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package dex
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"github.com/umbracle/go-web3/abi"
+	"github.com/umbracle/go-web3/contract/builtin/erc20"
+	"math/big"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Decoding fallbacks recorded on tokens whose symbol or name is not a valid ABI string
+const (
+	// FallbackBytes32 means the value was returned as bytes32, like MKR and SAI do
+	FallbackBytes32 = "bytes32"
+	// FallbackInvalidUTF8 means invalid UTF-8 sequences were replaced
+	FallbackInvalidUTF8 = "invalid_utf8"
+)
+
+// Token is the ERC20 metadata of a pair token. Fields the token contract does not implement are left empty.
+// Symbol and Name are sanitized, RawSymbol and RawName are the hex encoded bytes read from chain.
+type Token struct {
+	Address         string   `json:"address"`
+	Symbol          string   `json:"symbol"`
+	Name            string   `json:"name"`
+	Decimals        int      `json:"decimals"`
+	TotalSupply     string   `json:"totalSupply"`
+	RawSymbol       string   `json:"rawSymbol,omitempty"`
+	RawName         string   `json:"rawName,omitempty"`
+	SymbolFallbacks []string `json:"symbolFallbacks,omitempty"`
+	NameFallbacks   []string `json:"nameFallbacks,omitempty"`
+}
+
+// stringOutput is the output of a method returning a single string
+var stringOutput = abi.MustNewType("tuple(string)")
+
+// decodeTokenString decodes the output of a symbol or name call, returned either as an ABI string or as
+// null padded bytes32. It returns the value with null characters removed and invalid UTF-8 replaced,
+// the hex encoded value as read from chain, and the fallbacks used.
+func decodeTokenString(raw []byte) (string, string, []string) {
+	var value string
+	var fallbacks []string
+	if out, err := abi.Decode(stringOutput, raw); err == nil {
+		value, _ = out.(map[string]interface{})["0"].(string)
+	} else if len(raw) == 32 {
+		value = string(raw)
+		fallbacks = append(fallbacks, FallbackBytes32)
+	}
+	var rawValue string
+	if value != "" {
+		rawValue = "0x" + hex.EncodeToString([]byte(value))
+	}
+	value = strings.ReplaceAll(value, "\x00", "")
+	if !utf8.ValidString(value) {
+		value = strings.ToValidUTF8(value, "\uFFFD")
+		fallbacks = append(fallbacks, FallbackInvalidUTF8)
+	}
+	return value, rawValue, fallbacks
+}
+
+// tokenMethods are the ERC20 methods making up the token metadata
+var tokenMethods = []string{"symbol", "name", "decimals", "totalSupply"}
+
+// tokenEntry is a token of the cache. Once ready, it holds the token, or the error fetching it for callers
+// waiting on the fetch. Entries failing to fetch are removed from the cache, so the next caller fetches again.
+type tokenEntry struct {
+	ready chan struct{}
+	token *Token
+	err   error
+}
+
+// tokenCache holds the metadata of every token fetched so far, shared by all workers of an exchange,
+// so each token is fetched once however many pairs it appears in
+type tokenCache struct {
+	m      sync.Mutex
+	tokens map[web3.Address]*tokenEntry
+	policy SanitizePolicy
+}
+
+func newTokenCache() *tokenCache {
+	return &tokenCache{tokens: map[web3.Address]*tokenEntry{}, policy: DefaultSanitizePolicy}
+}
+
+// claim returns the entries of the tokens, and the tokens the caller has to fetch as nobody fetched them yet
+func (tc *tokenCache) claim(tokens []web3.Address) ([]*tokenEntry, []web3.Address) {
+	tc.m.Lock()
+	defer tc.m.Unlock()
+	entries := make([]*tokenEntry, len(tokens))
+	var missing []web3.Address
+	for i, token := range tokens {
+		e, ok := tc.tokens[token]
+		if !ok {
+			e = &tokenEntry{ready: make(chan struct{})}
+			tc.tokens[token] = e
+			missing = append(missing, token)
+		}
+		entries[i] = e
+	}
+	return entries, missing
+}
+
+// release stores a fetched token, or forgets a claimed token on error so another caller fetches it again
+func (tc *tokenCache) release(token web3.Address, fetched *Token, err error) {
+	tc.m.Lock()
+	defer tc.m.Unlock()
+	e := tc.tokens[token]
+	if err != nil {
+		delete(tc.tokens, token)
+		e.err = err
+	} else {
+		e.token = fetched
+	}
+	close(e.ready)
+}
+
+// get returns the metadata of the token, fetching it with single calls when it is not cached yet
+func (tc *tokenCache) get(
+	ctx context.Context, token web3.Address, provider contracts.Provider, block web3.BlockNumber,
+) (*Token, error) {
+	if token == zeroAddress {
+		return nil, nil
+	}
+	entries, missing := tc.claim([]web3.Address{token})
+	if len(missing) > 0 {
+		fetched, err := fetchToken(ctx, token, provider, block)
+		if err == nil {
+			tc.sanitize(fetched)
+		}
+		tc.release(token, fetched, err)
+	}
+	select {
+	case <-entries[0].ready:
+		return entries[0].token, entries[0].err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// getBatch returns the metadata of the tokens keyed by address, and the errors of tokens that could not
+// be fetched. Tokens not cached yet are fetched through the batcher. err is set when no token could be fetched.
+func (tc *tokenCache) getBatch(
+	ctx context.Context, b callBatcher, tokens []web3.Address, block web3.BlockNumber,
+) (map[web3.Address]*Token, map[web3.Address]error, error) {
+	entries, missing := tc.claim(tokens)
+	if len(missing) > 0 {
+		fetched, errs, err := fetchTokens(ctx, b, missing, block)
+		for i, token := range missing {
+			if err != nil {
+				tc.release(token, nil, err)
+				continue
+			}
+			if errs[i] == nil {
+				tc.sanitize(fetched[i])
+			}
+			tc.release(token, fetched[i], errs[i])
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	result := make(map[web3.Address]*Token, len(tokens))
+	errs := map[web3.Address]error{}
+	for i, e := range entries {
+		select {
+		case <-e.ready:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		if e.err != nil {
+			errs[tokens[i]] = e.err
+			continue
+		}
+		result[tokens[i]] = e.token
+	}
+	return result, errs, nil
+}
+
+// callError returns the error of an optional metadata call unless the call failed the same way on every
+// attempt, e.g. reverted because the contract does not implement the method, which leaves the field empty.
+// Tokens and pairs are not kept while a call fails for a reason that may go away.
+func callError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil && ClassifyError(err) != ErrorClassPermanent {
+		return err
+	}
+	return nil
+}
+
+// fetchToken fetches the metadata of the token with a call per method
+func fetchToken(
+	ctx context.Context, token web3.Address, provider contracts.Provider, block web3.BlockNumber,
+) (*Token, error) {
+	tokenContract := contracts.NewERC20(token, provider)
+	rawSymbol, err := tokenContract.Contract().CallRaw(ctx, "symbol", block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
+	}
+	rawName, err := tokenContract.Contract().CallRaw(ctx, "name", block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
+	}
+	decimals, err := tokenContract.Decimals(ctx, block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
+	}
+	totalSupply, err := tokenContract.TotalSupply(ctx, block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
+	}
+	t := &Token{
+		Address:  strings.ToLower(token.String()),
+		Decimals: int(decimals),
+	}
+	t.Symbol, t.RawSymbol, t.SymbolFallbacks = decodeTokenString(rawSymbol)
+	t.Name, t.RawName, t.NameFallbacks = decodeTokenString(rawName)
+	if err == nil {
+		t.TotalSupply = totalSupply.String()
+	}
+	return t, nil
+}
+
+// fetchTokens fetches the metadata of the tokens through the batcher. errs holds the error of every token
+// with a call failing for a reason that may go away.
+func fetchTokens(
+	ctx context.Context, b callBatcher, tokens []web3.Address, block web3.BlockNumber,
+) ([]*Token, []error, error) {
+	calls := make([]contractCall, 0, len(tokens)*len(tokenMethods))
+	for _, token := range tokens {
+		for _, method := range tokenMethods {
+			calls = append(calls, newContractCall(token, erc20.ERC20Abi(), method))
+		}
+	}
+	results, err := b.aggregate(ctx, calls, block)
+	if err != nil {
+		return nil, nil, err
+	}
+	fetched := make([]*Token, len(tokens))
+	errs := make([]error, len(tokens))
+	for i, token := range tokens {
+		r := results[i*len(tokenMethods) : (i+1)*len(tokenMethods)]
+		for _, res := range r {
+			if err := callError(ctx, res.err); err != nil {
+				errs[i] = err
+				break
+			}
+		}
+		if errs[i] != nil {
+			continue
+		}
+		decimals, _ := r[2].out["0"].(uint8)
+		fetched[i] = &Token{
+			Address:  strings.ToLower(token.String()),
+			Decimals: int(decimals),
+		}
+		fetched[i].Symbol, fetched[i].RawSymbol, fetched[i].SymbolFallbacks = decodeTokenString(r[0].raw)
+		fetched[i].Name, fetched[i].RawName, fetched[i].NameFallbacks = decodeTokenString(r[1].raw)
+		if totalSupply, ok := r[3].out["0"].(*big.Int); ok {
+			fetched[i].TotalSupply = totalSupply.String()
+		}
+	}
+	return fetched, errs, nil
+}
+
+// sanitize sanitizes the symbol and name of the token with the policy of the cache
+func (tc *tokenCache) sanitize(t *Token) *Token {
+	t.Symbol = tc.policy.Symbol(t.Symbol)
+	t.Name = tc.policy.Name(t.Name)
+	return t
+}
+
+// symbol returns the symbol of the token used in pair names, or the policy replacement if it is unknown
+func (tc *tokenCache) symbol(t *Token) string {
+	if t == nil {
+		return tc.policy.Replacement
+	}
+	return t.Symbol
+}
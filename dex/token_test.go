@@ -0,0 +1,58 @@
+package dex
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeTokenString(t *testing.T) {
+	abiString := func(value string) []byte {
+		out, err := stringOutput.Encode([]interface{}{value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	bytes32 := func(value string) []byte {
+		out := make([]byte, 32)
+		copy(out, value)
+		return out
+	}
+	tests := []struct {
+		name      string
+		raw       []byte
+		value     string
+		rawValue  string
+		fallbacks []string
+	}{
+		{name: "string", raw: abiString("DAI"), value: "DAI", rawValue: "0x444149"},
+		{name: "empty string", raw: abiString(""), value: ""},
+		{name: "null characters", raw: abiString("A\x00B\x00"), value: "AB", rawValue: "0x41004200"},
+		{
+			name: "bytes32", raw: bytes32("MKR"), value: "MKR",
+			rawValue: "0x" + hex.EncodeToString(bytes32("MKR")), fallbacks: []string{FallbackBytes32},
+		},
+		{
+			name: "invalid utf8", raw: abiString("\xffABC"), value: "�ABC",
+			rawValue: "0xff414243", fallbacks: []string{FallbackInvalidUTF8},
+		},
+		{
+			name: "invalid utf8 bytes32", raw: bytes32("\xfe\xffX"), value: "�X",
+			rawValue:  "0x" + hex.EncodeToString(bytes32("\xfe\xffX")),
+			fallbacks: []string{FallbackBytes32, FallbackInvalidUTF8},
+		},
+		{name: "not a string", raw: []byte{1, 2, 3}, value: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, rawValue, fallbacks := decodeTokenString(tt.raw)
+			if value != tt.value || rawValue != tt.rawValue || !reflect.DeepEqual(fallbacks, tt.fallbacks) {
+				t.Errorf(
+					"expected %q, %q, %v, got %q, %q, %v",
+					tt.value, tt.rawValue, tt.fallbacks, value, rawValue, fallbacks,
+				)
+			}
+		})
+	}
+}
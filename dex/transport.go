@@ -0,0 +1,331 @@
+package dex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"github.com/umbracle/go-web3/jsonrpc"
+	"golang.org/x/exp/slog"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type rpcRequest struct {
+	JsonRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+type httpStatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+// batchProvider is implemented by providers able to send several requests in one JSON-RPC batch
+type batchProvider interface {
+	batchCall(ctx context.Context, requests []rpcRequest) (map[uint64]*rpcResponse, error)
+}
+
+// HTTPTransport sends JSON-RPC requests to the node over HTTP
+type HTTPTransport struct {
+	url    string
+	client *http.Client
+	nextId uint64
+}
+
+// NewHTTPTransport creates a new HTTPTransport for the node at url
+func NewHTTPTransport(url string) *HTTPTransport {
+	return &HTTPTransport{
+		url:    url,
+		client: &http.Client{},
+	}
+}
+
+// Call makes a jsonrpc call
+func (t *HTTPTransport) Call(ctx context.Context, method string, out interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	req := rpcRequest{JsonRPC: "2.0", ID: atomic.AddUint64(&t.nextId, 1), Method: method, Params: params}
+	var res rpcResponse
+	if err := t.post(ctx, req, &res); err != nil {
+		return err
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	return json.Unmarshal(res.Result, out)
+}
+
+// batchCall sends requests as a single JSON-RPC batch and returns responses keyed by request id
+func (t *HTTPTransport) batchCall(ctx context.Context, requests []rpcRequest) (map[uint64]*rpcResponse, error) {
+	var batch []*rpcResponse
+	if err := t.post(ctx, requests, &batch); err != nil {
+		return nil, err
+	}
+	responses := make(map[uint64]*rpcResponse, len(batch))
+	for _, r := range batch {
+		responses[r.ID] = r
+	}
+	return responses, nil
+}
+
+func (t *HTTPTransport) post(ctx context.Context, body interface{}, out interface{}) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := t.client.Do(req)
+	if err != nil {
+		return redactURL(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return &httpStatusError{
+			StatusCode: res.StatusCode,
+			Body:       strings.TrimSpace(string(data)),
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
+	return json.Unmarshal(data, out)
+}
+
+// parseRetryAfter parses the Retry-After header, given either in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// clientProvider adapts the go-web3 jsonrpc client, which does not take a context. A call is abandoned
+// once the context is done, while the client finishes it in the background.
+type clientProvider struct {
+	client *jsonrpc.Client
+}
+
+// Call makes a jsonrpc call
+func (cp *clientProvider) Call(ctx context.Context, method string, out interface{}, params ...interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// the result is decoded into out only when the call is not abandoned, so it is never written concurrently
+	var raw json.RawMessage
+	done := make(chan error, 1)
+	go func() {
+		done <- cp.client.Call(method, &raw, params...)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(raw, out)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// timeoutProvider gives every call of the wrapped provider its own deadline
+type timeoutProvider struct {
+	provider contracts.Provider
+	timeout  time.Duration
+}
+
+// Call makes a jsonrpc call
+func (tp *timeoutProvider) Call(ctx context.Context, method string, out interface{}, params ...interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, tp.timeout)
+	defer cancel()
+	return tp.provider.Call(ctx, method, out, params...)
+}
+
+func (tp *timeoutProvider) batchCall(ctx context.Context, requests []rpcRequest) (map[uint64]*rpcResponse, error) {
+	bp, ok := tp.provider.(batchProvider)
+	if !ok {
+		return nil, errBatchUnsupported
+	}
+	ctx, cancel := context.WithTimeout(ctx, tp.timeout)
+	defer cancel()
+	return bp.batchCall(ctx, requests)
+}
+
+// newTransport creates the transport for the node at nodeUrl. HTTP nodes are served by HTTPTransport,
+// websocket and IPC nodes by the go-web3 jsonrpc client.
+func newTransport(nodeUrl string) (contracts.Provider, error) {
+	if strings.HasPrefix(nodeUrl, "http://") || strings.HasPrefix(nodeUrl, "https://") {
+		return NewHTTPTransport(nodeUrl), nil
+	}
+	client, err := jsonrpc.NewClient(nodeUrl)
+	if err != nil {
+		return nil, redactURL(err)
+	}
+	return &clientProvider{client: client}, nil
+}
+
+// ProviderConfig configures the provider shared by the DEX implementations
+type ProviderConfig struct {
+	Endpoints []Endpoint
+	// Strategy defaults to RoundRobin and Cooldown to DefaultCooldown
+	Strategy     BalanceStrategy
+	Cooldown     time.Duration
+	AdaptiveRate bool
+	// Retry defaults to DefaultRetryPolicy when MaxAttempts is 0
+	Retry RetryPolicy
+	// CallTimeout is the deadline of every attempt of a call, 0 for none
+	CallTimeout time.Duration
+	// Logger logs retries, throttling and endpoint cooldowns, and defaults to slog.Default
+	Logger *slog.Logger
+}
+
+// NewProvider creates a provider spreading calls across the configured endpoints.
+// Every call is retried according to the retry policy, each attempt possibly on a different endpoint.
+func NewProvider(config ProviderConfig) (contracts.Provider, error) {
+	pool, err := NewEndpointPool(
+		config.Endpoints, config.Strategy, config.Cooldown, config.AdaptiveRate, config.CallTimeout,
+	)
+	if err != nil {
+		return nil, err
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	pool.SetLogger(logger)
+	policy := config.Retry
+	if policy.MaxAttempts == 0 {
+		policy = DefaultRetryPolicy()
+	}
+	return &retryProvider{provider: pool, policy: policy, logger: logger}, nil
+}
+
+// GetBlockNumber returns the number of the most recent block
+func GetBlockNumber(ctx context.Context, provider contracts.Provider) (uint64, error) {
+	var out string
+	if err := provider.Call(ctx, "eth_blockNumber", &out); err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimPrefix(out, "0x"), 16, 64)
+}
+
+// GetBlockHash returns the hash of the block
+func GetBlockHash(ctx context.Context, provider contracts.Provider, block uint64) (web3.Hash, error) {
+	header, err := getBlockHeader(ctx, provider, block)
+	if err != nil {
+		return web3.Hash{}, err
+	}
+	if header == nil {
+		return web3.Hash{}, fmt.Errorf("block %d not found", block)
+	}
+	return header.Hash, nil
+}
+
+// blockHeader is the part of a block header needed to follow the chain
+type blockHeader struct {
+	Number     uint64
+	Hash       web3.Hash
+	ParentHash web3.Hash
+}
+
+// getBlockHeader returns the header of the block, or nil if the node does not have the block
+func getBlockHeader(ctx context.Context, provider contracts.Provider, block uint64) (*blockHeader, error) {
+	var out *struct {
+		Hash       web3.Hash `json:"hash"`
+		ParentHash web3.Hash `json:"parentHash"`
+	}
+	if err := provider.Call(ctx, "eth_getBlockByNumber", &out, web3.BlockNumber(block).String(), false); err != nil {
+		return nil, err
+	}
+	if out == nil {
+		return nil, nil
+	}
+	return &blockHeader{Number: block, Hash: out.Hash, ParentHash: out.ParentHash}, nil
+}
+
+// getLogs returns all logs matching the filter
+func getLogs(ctx context.Context, provider contracts.Provider, filter *web3.LogFilter) ([]*web3.Log, error) {
+	var out []*web3.Log
+	if err := provider.Call(ctx, "eth_getLogs", &out, filter); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// scanLogs returns all logs of the address with the topic between from and to blocks (inclusive), requesting
+// at most blockRange blocks per call. Ranges rejected by the node are halved until they are accepted.
+func scanLogs(
+	ctx context.Context, provider contracts.Provider, address web3.Address, topic web3.Hash, from uint64, to uint64,
+	blockRange uint64, logger *slog.Logger,
+) ([]*web3.Log, error) {
+	var logs []*web3.Log
+	for start := from; start <= to; {
+		end := start + blockRange - 1
+		if end > to {
+			end = to
+		}
+		filter := &web3.LogFilter{
+			Address: []web3.Address{address},
+			Topics:  []*web3.Hash{&topic},
+		}
+		filter.SetFromUint64(start)
+		filter.SetToUint64(end)
+		found, err := getLogs(ctx, provider, filter)
+		if err != nil {
+			if blockRange == 1 || ctx.Err() != nil {
+				return nil, err
+			}
+			blockRange /= 2
+			logger.Warn(
+				"Error getting logs, retrying with a smaller range",
+				"from", start, "to", end, "range", blockRange, "error", err,
+			)
+			continue
+		}
+		logger.Debug("Scanned blocks", "from", start, "to", end, "logs", len(found))
+		logs = append(logs, found...)
+		start = end + 1
+	}
+	return logs, nil
+}
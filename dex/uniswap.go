@@ -1,86 +1,150 @@
 package dex
 
 import (
+	"context"
 	"fmt"
 	"github.com/nikolalosic/dex-pairs/contracts"
 	"github.com/umbracle/go-web3"
-	"github.com/umbracle/go-web3/contract/builtin/erc20"
-	"github.com/umbracle/go-web3/jsonrpc"
-	"log"
+	"golang.org/x/exp/slog"
 	"math/big"
 	"strings"
 )
 
 type Uniswap struct {
-	factory *contracts.UniswapFactory
-	client  *jsonrpc.Client
-	chainId int
+	factory  *contracts.UniswapFactory
+	provider contracts.Provider
+	chainId  int
+	batcher  callBatcher
+	block    web3.BlockNumber
+	tokens   *tokenCache
+	logger   *slog.Logger
 }
 
 // NewUniswap creates a new instance of the Uniswap DEX
-func NewUniswap(factoryAddress web3.Address, chainId int, nodeUrl string) (*Uniswap, error) {
-	client, err := jsonrpc.NewClient(nodeUrl)
-	if err != nil {
-		log.Printf("Error openning rpc client")
-		return nil, err
-	}
+func NewUniswap(factoryAddress web3.Address, chainId int, provider contracts.Provider) (*Uniswap, error) {
 	return &Uniswap{
-		factory: contracts.NewUniswapFactory(factoryAddress, client),
-		client:  client,
-		chainId: chainId,
+		factory:  contracts.NewUniswapFactory(factoryAddress, provider),
+		provider: provider,
+		chainId:  chainId,
+		block:    web3.Latest,
+		tokens:   newTokenCache(),
+		logger:   slog.Default(),
 	}, nil
 }
 
-func (us *Uniswap) GetPair(n int64) (*Pair, error) {
-	log.Printf("Getting Uniswap pair. n=%d", n)
-	pairAddress, err := us.factory.AllPairs(n, web3.Latest)
+func (us *Uniswap) GetPair(ctx context.Context, n int64) (*Pair, error) {
+	us.logger.Debug("Getting Uniswap pair", "pairIndex", n)
+	pairAddress, err := us.factory.AllPairs(ctx, n, us.block)
 	if err != nil {
 		return nil, err
 	}
-	pairContract := contracts.NewUniswapPair(pairAddress, us.client)
-	pairSymbol, _ := pairContract.Symbol(web3.Latest)
-	pairName, _ := pairContract.Name(web3.Latest)
-	pairDecimals, _ := pairContract.Decimals(web3.Latest)
-
-	token0, _ := pairContract.Token0(web3.Latest)
-	token1, _ := pairContract.Token1(web3.Latest)
-
-	token0Contract := erc20.NewERC20(token0, us.client)
-	token1Contract := erc20.NewERC20(token1, us.client)
-
-	token0Symbol := "UNK"
-	token1Symbol := "UNK"
-	if token0Contract.Contract().Addr() != zeroAddress {
-		token0Symbol, err = token0Contract.Symbol(web3.Latest)
-		if err != nil || !allowedRegex.MatchString(token0Symbol) {
-			token0Symbol = "UNK"
-		}
+	pairContract := contracts.NewUniswapPair(pairAddress, us.provider)
+	pairSymbol, err := pairContract.Symbol(ctx, us.block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
+	}
+	pairName, err := pairContract.Name(ctx, us.block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
+	}
+	pairDecimals, err := pairContract.Decimals(ctx, us.block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
+	}
+
+	token0, err := pairContract.Token0(ctx, us.block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
 	}
-	if token1Contract.Contract().Addr() != zeroAddress {
-		token1Symbol, err = token1Contract.Symbol(web3.Latest)
-		if err != nil || !allowedRegex.MatchString(token1Symbol) {
-			token1Symbol = "UNK"
-		}
+	token1, err := pairContract.Token1(ctx, us.block)
+	if err := callError(ctx, err); err != nil {
+		return nil, err
 	}
-	if len(token0Symbol) > 13 {
-		token0Symbol = token0Symbol[:13]
+
+	token0Info, err := us.tokens.get(ctx, token0, us.provider, us.block)
+	if err != nil {
+		return nil, err
 	}
-	if len(token1Symbol) > 13 {
-		token0Symbol = token1Symbol[:13]
+	token1Info, err := us.tokens.get(ctx, token1, us.provider, us.block)
+	if err != nil {
+		return nil, err
 	}
 
+	token0Symbol := us.tokens.symbol(token0Info)
+	token1Symbol := us.tokens.symbol(token1Info)
+
 	pair := Pair{
-		Token0:   strings.ToLower(token0.String()),
-		Token1:   strings.ToLower(token1.String()),
-		Name:     fmt.Sprintf("%s - %s/%s", pairName, token0Symbol, token1Symbol),
-		Address:  strings.ToLower(pairAddress.String()),
-		Symbol:   pairSymbol,
-		Decimals: int(pairDecimals),
-		ChainId:  us.chainId,
+		Index:      n,
+		Token0:     strings.ToLower(token0.String()),
+		Token1:     strings.ToLower(token1.String()),
+		Token0Info: token0Info,
+		Token1Info: token1Info,
+		Name:       fmt.Sprintf("%s - %s/%s", pairName, token0Symbol, token1Symbol),
+		Address:    strings.ToLower(pairAddress.String()),
+		Symbol:     pairSymbol,
+		Decimals:   int(pairDecimals),
+		ChainId:    us.chainId,
 	}
 	return &pair, nil
 }
 
-func (us *Uniswap) GetPairNumber() (*big.Int, error) {
-	return us.factory.AllPairsLength(web3.Latest)
+func (us *Uniswap) GetPairNumber(ctx context.Context) (*big.Int, error) {
+	return us.factory.AllPairsLength(ctx, us.block)
+}
+
+// EnableMulticall makes GetPairs batch its calls through the Multicall3 contract at the given address
+func (us *Uniswap) EnableMulticall(address web3.Address, batchSize int) {
+	us.batcher = NewMulticall(address, us.provider, batchSize)
+}
+
+// EnableBatchTransport makes GetPairs send its calls as JSON-RPC batches
+func (us *Uniswap) EnableBatchTransport(batchSize int) {
+	bt := NewBatchTransport(us.provider, batchSize)
+	bt.SetLogger(us.logger)
+	us.batcher = bt
+}
+
+// GetPairs returns pairs in the [start, end) range, with errors reported per pair
+func (us *Uniswap) GetPairs(ctx context.Context, start int64, end int64) ([]*Pair, []error) {
+	if us.batcher == nil {
+		return getPairsOneByOne(ctx, us, start, end)
+	}
+	us.logger.Debug("Getting pairs in batch", "start", start, "end", end)
+	return getV2Pairs(ctx, us.batcher, us.tokens, us.factory.Contract(), start, end, us.chainId, us.block)
+}
+
+// GetPairStates sets the state of every pair at the block
+func (us *Uniswap) GetPairStates(ctx context.Context, pairs []*Pair, block uint64) []error {
+	if us.batcher != nil {
+		us.logger.Debug("Getting pair states in batch", "pairs", len(pairs), "block", block)
+	}
+	return getV2PairStates(ctx, us.batcher, us.provider, pairs, block)
+}
+
+// SetBlock pins every call to the block
+func (us *Uniswap) SetBlock(block web3.BlockNumber) {
+	us.block = block
+}
+
+// SetSanitizePolicy sets the policy token symbols and names are sanitized with
+func (us *Uniswap) SetSanitizePolicy(policy SanitizePolicy) {
+	us.tokens.policy = policy
+}
+
+// SetLogger sets the logger of the exchange
+func (us *Uniswap) SetLogger(logger *slog.Logger) {
+	us.logger = logger
+	if bt, ok := us.batcher.(*BatchTransport); ok {
+		bt.SetLogger(logger)
+	}
+}
+
+// PairCreatedFilter returns the factory address and the PairCreated topic
+func (us *Uniswap) PairCreatedFilter() (web3.Address, web3.Hash) {
+	return us.factory.Contract().Addr(), us.factory.PairCreatedEventSig()
+}
+
+// ParsePairCreated decodes a PairCreated log of the factory
+func (us *Uniswap) ParsePairCreated(log *web3.Log) (*contracts.PairCreatedEvent, error) {
+	return us.factory.ParsePairCreated(log)
 }
@@ -0,0 +1,97 @@
+package dex
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"golang.org/x/exp/slog"
+	"math/big"
+	"strings"
+)
+
+// EthAddress is the synthetic address used for native ETH, as Uniswap V1 exchanges trade tokens against ETH
+var EthAddress = web3.HexToAddress("0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee")
+
+// ethToken is the metadata of native ETH, the token1 of every Uniswap V1 pair
+var ethToken = &Token{
+	Address:  strings.ToLower(EthAddress.String()),
+	Symbol:   "ETH",
+	Name:     "Ether",
+	Decimals: 18,
+}
+
+type UniswapV1 struct {
+	factory  *contracts.UniswapV1Factory
+	provider contracts.Provider
+	chainId  int
+	block    web3.BlockNumber
+	tokens   *tokenCache
+	logger   *slog.Logger
+}
+
+// NewUniswapV1 creates a new instance of the Uniswap V1 DEX
+func NewUniswapV1(factoryAddress web3.Address, chainId int, provider contracts.Provider) (*UniswapV1, error) {
+	return &UniswapV1{
+		factory:  contracts.NewUniswapV1Factory(factoryAddress, provider),
+		provider: provider,
+		chainId:  chainId,
+		block:    web3.Latest,
+		tokens:   newTokenCache(),
+		logger:   slog.Default(),
+	}, nil
+}
+
+// GetPair returns the ERC20/ETH pair of the n-th V1 exchange
+func (us *UniswapV1) GetPair(ctx context.Context, n int64) (*Pair, error) {
+	us.logger.Debug("Getting Uniswap V1 exchange", "pairIndex", n)
+	token, err := us.factory.GetTokenWithId(ctx, n+1, us.block)
+	if err != nil {
+		return nil, err
+	}
+	exchangeAddress, err := us.factory.GetExchange(ctx, token, us.block)
+	if err != nil {
+		return nil, err
+	}
+	if exchangeAddress == zeroAddress {
+		return nil, fmt.Errorf("no exchange for token %s", token.String())
+	}
+
+	tokenInfo, err := us.tokens.get(ctx, token, us.provider, us.block)
+	if err != nil {
+		return nil, err
+	}
+
+	pair := Pair{
+		Index:      n,
+		Token0:     strings.ToLower(token.String()),
+		Token1:     strings.ToLower(EthAddress.String()),
+		Token0Info: tokenInfo,
+		Token1Info: ethToken,
+		Name:       fmt.Sprintf("Uniswap V1 - %s/ETH", us.tokens.symbol(tokenInfo)),
+		Address:    strings.ToLower(exchangeAddress.String()),
+		Symbol:     "UNI-V1",
+		Decimals:   18,
+		ChainId:    us.chainId,
+	}
+	return &pair, nil
+}
+
+func (us *UniswapV1) GetPairNumber(ctx context.Context) (*big.Int, error) {
+	return us.factory.TokenCount(ctx, us.block)
+}
+
+// SetBlock pins every call to the block
+func (us *UniswapV1) SetBlock(block web3.BlockNumber) {
+	us.block = block
+}
+
+// SetSanitizePolicy sets the policy token symbols and names are sanitized with
+func (us *UniswapV1) SetSanitizePolicy(policy SanitizePolicy) {
+	us.tokens.policy = policy
+}
+
+// SetLogger sets the logger of the exchange
+func (us *UniswapV1) SetLogger(logger *slog.Logger) {
+	us.logger = logger
+}
@@ -0,0 +1,158 @@
+package dex
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"golang.org/x/exp/slog"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// defaultLogBlockRange is the number of blocks requested per eth_getLogs call
+const defaultLogBlockRange = 10000
+
+type UniswapV3 struct {
+	factory    *contracts.UniswapV3Factory
+	provider   contracts.Provider
+	chainId    int
+	startBlock uint64
+	blockRange uint64
+	block      web3.BlockNumber
+	tokens     *tokenCache
+	logger     *slog.Logger
+
+	m       sync.Mutex
+	scanned bool
+	pools   []*contracts.PoolCreatedEvent
+}
+
+// NewUniswapV3 creates a new instance of the Uniswap V3 DEX. Pools are discovered by
+// scanning PoolCreated logs of the factory starting at startBlock.
+func NewUniswapV3(factoryAddress web3.Address, chainId int, provider contracts.Provider, startBlock uint64) (*UniswapV3, error) {
+	return &UniswapV3{
+		factory:    contracts.NewUniswapV3Factory(factoryAddress, provider),
+		provider:   provider,
+		chainId:    chainId,
+		startBlock: startBlock,
+		blockRange: defaultLogBlockRange,
+		block:      web3.Latest,
+		tokens:     newTokenCache(),
+		logger:     slog.Default(),
+	}, nil
+}
+
+// SetBlockRange sets the maximum number of blocks requested per eth_getLogs call
+func (us *UniswapV3) SetBlockRange(blockRange uint64) {
+	if blockRange > 0 {
+		us.blockRange = blockRange
+	}
+}
+
+// ScanPools returns all pools created by the factory between from and to blocks (inclusive).
+// Ranges rejected by the node are halved until they are accepted.
+func (us *UniswapV3) ScanPools(ctx context.Context, from uint64, to uint64) ([]*contracts.PoolCreatedEvent, error) {
+	logs, err := scanLogs(
+		ctx, us.provider, us.factory.Contract().Addr(), us.factory.PoolCreatedEventSig(), from, to, us.blockRange,
+		us.logger,
+	)
+	if err != nil {
+		return nil, err
+	}
+	pools := make([]*contracts.PoolCreatedEvent, 0, len(logs))
+	for _, l := range logs {
+		pool, err := us.factory.ParsePoolCreated(l)
+		if err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+func (us *UniswapV3) scan(ctx context.Context) error {
+	us.m.Lock()
+	defer us.m.Unlock()
+	if us.scanned {
+		return nil
+	}
+	head := uint64(us.block)
+	if us.block < 0 {
+		var err error
+		head, err = GetBlockNumber(ctx, us.provider)
+		if err != nil {
+			return err
+		}
+	}
+	pools, err := us.ScanPools(ctx, us.startBlock, head)
+	if err != nil {
+		return err
+	}
+	us.pools = pools
+	us.scanned = true
+	return nil
+}
+
+func (us *UniswapV3) GetPair(ctx context.Context, n int64) (*Pair, error) {
+	us.logger.Debug("Getting Uniswap V3 pool", "pairIndex", n)
+	if err := us.scan(ctx); err != nil {
+		return nil, err
+	}
+	if n < 0 || n >= int64(len(us.pools)) {
+		return nil, fmt.Errorf("pool index %d out of range", n)
+	}
+	pool := us.pools[n]
+
+	token0Info, err := us.tokens.get(ctx, pool.Token0, us.provider, us.block)
+	if err != nil {
+		return nil, err
+	}
+	token1Info, err := us.tokens.get(ctx, pool.Token1, us.provider, us.block)
+	if err != nil {
+		return nil, err
+	}
+
+	pair := Pair{
+		Index:       n,
+		Token0:      strings.ToLower(pool.Token0.String()),
+		Token1:      strings.ToLower(pool.Token1.String()),
+		Token0Info:  token0Info,
+		Token1Info:  token1Info,
+		Name:        fmt.Sprintf("Uniswap V3 - %s/%s %s", us.tokens.symbol(token0Info), us.tokens.symbol(token1Info), formatFee(pool.Fee)),
+		Address:     strings.ToLower(pool.Pool.String()),
+		Symbol:      "UNI-V3-POS",
+		ChainId:     us.chainId,
+		Fee:         pool.Fee,
+		TickSpacing: pool.TickSpacing,
+	}
+	return &pair, nil
+}
+
+func (us *UniswapV3) GetPairNumber(ctx context.Context) (*big.Int, error) {
+	if err := us.scan(ctx); err != nil {
+		return nil, err
+	}
+	return big.NewInt(int64(len(us.pools))), nil
+}
+
+// formatFee formats a fee tier expressed in hundredths of a bip as a percentage
+func formatFee(fee int64) string {
+	return fmt.Sprintf("%g%%", float64(fee)/10000)
+}
+
+// SetBlock pins every call to the block. Only pools created up to the block are scanned.
+func (us *UniswapV3) SetBlock(block web3.BlockNumber) {
+	us.block = block
+}
+
+// SetSanitizePolicy sets the policy token symbols and names are sanitized with
+func (us *UniswapV3) SetSanitizePolicy(policy SanitizePolicy) {
+	us.tokens.policy = policy
+}
+
+// SetLogger sets the logger of the exchange
+func (us *UniswapV3) SetLogger(logger *slog.Logger) {
+	us.logger = logger
+}
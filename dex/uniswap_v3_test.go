@@ -0,0 +1,236 @@
+package dex
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"github.com/umbracle/go-web3/abi"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var testV3Factory = web3.HexToAddress("0x1F98431c8aD98523631AE4a59f267346ea31F984")
+
+// testPool is a pool of the test factory created at block
+type testPool struct {
+	event contracts.PoolCreatedEvent
+	block uint64
+}
+
+var testPools = []testPool{
+	{contracts.PoolCreatedEvent{
+		Token0: web3.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), Token1: testWETH,
+		Fee: 500, TickSpacing: 10, Pool: web3.HexToAddress("0x88e6A0c2dDD26FEEb64F039a2c41296FcB3f5640"),
+	}, 10},
+	{contracts.PoolCreatedEvent{
+		Token0: web3.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"), Token1: testWETH,
+		Fee: 3000, TickSpacing: 60, Pool: web3.HexToAddress("0x8ad599c3A0ff1De082011EFDDc58f1908eb6e6D8"),
+	}, 20},
+	{contracts.PoolCreatedEvent{
+		Token0: web3.HexToAddress("0x2260FAC5E5542a773Aa44fBCfeDf7C193bc2C599"), Token1: testWETH,
+		Fee: 10000, TickSpacing: 200, Pool: web3.HexToAddress("0xCBCdF9626bC03E24f779434178A73a0B4bad62eD"),
+	}, 35},
+	{contracts.PoolCreatedEvent{
+		Token0: web3.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F"),
+		Token1: web3.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"),
+		Fee:    100, TickSpacing: 1, Pool: web3.HexToAddress("0x5777d92f208679DB4b9778590Fa3CAB3aC9e2168"),
+	}, 60},
+}
+
+var testWETH = web3.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+
+// poolCreatedLog encodes the PoolCreated log of the pool
+func poolCreatedLog(t *testing.T, p testPool) *web3.Log {
+	factory := contracts.NewUniswapV3Factory(testV3Factory, nil)
+	data, err := abi.Encode(
+		[]interface{}{big.NewInt(p.event.TickSpacing), p.event.Pool}, abi.MustNewType("tuple(int24,address)"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var token0, token1, fee web3.Hash
+	copy(token0[12:], p.event.Token0[:])
+	copy(token1[12:], p.event.Token1[:])
+	big.NewInt(p.event.Fee).FillBytes(fee[:])
+	return &web3.Log{
+		Address:     testV3Factory,
+		Topics:      []web3.Hash{factory.PoolCreatedEventSig(), token0, token1, fee},
+		Data:        data,
+		BlockNumber: p.block,
+	}
+}
+
+// logRanges serves eth_getLogs of the pools, rejecting ranges of more than maxRange blocks like nodes
+// limiting the results of a query. It records accepted and rejected ranges.
+type logRanges struct {
+	m        sync.Mutex
+	logs     []*web3.Log
+	maxRange uint64
+	accepted [][2]uint64
+	rejected int
+}
+
+func (lr *logRanges) getLogs(params []json.RawMessage) (interface{}, error) {
+	var filter struct {
+		FromBlock json.RawMessage `json:"fromBlock"`
+		ToBlock   json.RawMessage `json:"toBlock"`
+	}
+	if err := json.Unmarshal(params[0], &filter); err != nil {
+		return nil, err
+	}
+	from, err := parseQuantity(filter.FromBlock)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseQuantity(filter.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	lr.m.Lock()
+	defer lr.m.Unlock()
+	if lr.maxRange > 0 && to-from+1 > lr.maxRange {
+		lr.rejected++
+		return nil, &rpcError{Code: -32602, Message: "query returned more than 10000 results"}
+	}
+	lr.accepted = append(lr.accepted, [2]uint64{from, to})
+	found := []*web3.Log{}
+	for _, l := range lr.logs {
+		if l.BlockNumber >= from && l.BlockNumber <= to {
+			found = append(found, l)
+		}
+	}
+	return found, nil
+}
+
+func TestUniswapV3ScanPools(t *testing.T) {
+	lr := &logRanges{maxRange: 25}
+	for _, p := range testPools {
+		lr.logs = append(lr.logs, poolCreatedLog(t, p))
+	}
+	node := newTestNode(t, map[string]rpcHandler{"eth_getLogs": lr.getLogs})
+	us, err := NewUniswapV3(testV3Factory, 1, NewHTTPTransport(node.URL), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us.SetBlockRange(100)
+
+	pools, err := us.ScanPools(context.Background(), 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != len(testPools) {
+		t.Fatalf("expected %d pools, got %d", len(testPools), len(pools))
+	}
+	for i, pool := range pools {
+		if *pool != testPools[i].event {
+			t.Errorf("pool %d: expected %+v, got %+v", i, testPools[i].event, *pool)
+		}
+	}
+
+	// 100 and 50 blocks are rejected, then the range stays at 25 blocks
+	lr.m.Lock()
+	defer lr.m.Unlock()
+	if lr.rejected != 2 {
+		t.Errorf("expected 2 rejected ranges, got %d", lr.rejected)
+	}
+	next := uint64(0)
+	for _, r := range lr.accepted {
+		if r[0] != next || r[1]-r[0]+1 > lr.maxRange {
+			t.Fatalf("unexpected range %v after block %d", r, next)
+		}
+		next = r[1] + 1
+	}
+	if next != 101 {
+		t.Errorf("expected blocks up to 100 scanned, got %d", next-1)
+	}
+}
+
+func TestUniswapV3ScanPoolsFailsOnSingleBlock(t *testing.T) {
+	var m sync.Mutex
+	rejected := 0
+	node := newTestNode(t, map[string]rpcHandler{
+		"eth_getLogs": func(params []json.RawMessage) (interface{}, error) {
+			m.Lock()
+			defer m.Unlock()
+			rejected++
+			return nil, &rpcError{Code: -32602, Message: "query returned more than 10000 results"}
+		},
+	})
+	us, err := NewUniswapV3(testV3Factory, 1, NewHTTPTransport(node.URL), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	us.SetBlockRange(8)
+
+	if _, err := us.ScanPools(context.Background(), 0, 100); err == nil {
+		t.Fatal("expected error when a single block is rejected")
+	}
+	// ranges of 8, 4, 2 and 1 blocks
+	m.Lock()
+	defer m.Unlock()
+	if rejected != 4 {
+		t.Errorf("expected 4 rejected ranges, got %d", rejected)
+	}
+}
+
+func TestUniswapV3GetPair(t *testing.T) {
+	lr := &logRanges{}
+	for _, p := range testPools {
+		lr.logs = append(lr.logs, poolCreatedLog(t, p))
+	}
+	node := newTestNode(t, map[string]rpcHandler{
+		"eth_getLogs": lr.getLogs,
+		"eth_call": tokenCalls(map[web3.Address]testToken{
+			testPools[0].event.Token0: {symbol: "USDC", name: "USD Coin", decimals: 6, supply: 1000},
+			testWETH:                  {symbol: "WETH", name: "Wrapped Ether", decimals: 18, supply: 2000},
+		}),
+	})
+	us, err := NewUniswapV3(testV3Factory, 1, NewHTTPTransport(node.URL), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pools created after the pinned block are left out
+	us.SetBlock(web3.BlockNumber(30))
+	ctx := context.Background()
+
+	n, err := us.GetPairNumber(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Int64() != 2 {
+		t.Fatalf("expected 2 pools up to block 30, got %d", n.Int64())
+	}
+	if node.count("eth_blockNumber") != 0 {
+		t.Error("expected no eth_blockNumber call for a pinned block")
+	}
+
+	pair, err := us.GetPair(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testPools[1].event
+	if pair.Index != 1 || pair.Fee != want.Fee || pair.TickSpacing != want.TickSpacing || pair.ChainId != 1 {
+		t.Errorf("unexpected pair %+v", pair)
+	}
+	if pair.Address != strings.ToLower(want.Pool.String()) || pair.Token0 != strings.ToLower(want.Token0.String()) ||
+		pair.Token1 != strings.ToLower(want.Token1.String()) {
+		t.Errorf("unexpected addresses of pair %+v", pair)
+	}
+	if pair.Name != "Uniswap V3 - USDC/WETH 0.3%" {
+		t.Errorf("unexpected name %s", pair.Name)
+	}
+	if pair.Token0Info == nil || pair.Token0Info.Decimals != 6 || pair.Token0Info.TotalSupply != "1000" {
+		t.Errorf("unexpected token0 %+v", pair.Token0Info)
+	}
+	if pair.Token1Info == nil || pair.Token1Info.Name != "Wrapped Ether" || pair.Token1Info.Decimals != 18 {
+		t.Errorf("unexpected token1 %+v", pair.Token1Info)
+	}
+
+	if _, err := us.GetPair(ctx, 2); err == nil {
+		t.Error("expected error for a pool index out of range")
+	}
+}
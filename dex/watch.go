@@ -0,0 +1,405 @@
+package dex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"golang.org/x/exp/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WatchDexExchange is a DexExchange whose new pairs are announced by PairCreated logs of its factory
+type WatchDexExchange interface {
+	DexExchange
+	// PairCreatedFilter returns the address and topic of logs announcing new pairs
+	PairCreatedFilter() (web3.Address, web3.Hash)
+	// ParsePairCreated decodes a log announcing a new pair
+	ParsePairCreated(log *web3.Log) (*contracts.PairCreatedEvent, error)
+}
+
+// PairUpdate is a change of the watched pairs
+type PairUpdate struct {
+	// Added are new pairs, pending until they have enough confirmations
+	Added []*Pair
+	// Removed are indices of pending pairs whose blocks were dropped by a reorg
+	Removed []int64
+	// Finalized are indices of pending pairs which got enough confirmations
+	Finalized []int64
+	// Block is the block the watcher synced to
+	Block uint64
+}
+
+func (u *PairUpdate) empty() bool {
+	return len(u.Added) == 0 && len(u.Removed) == 0 && len(u.Finalized) == 0
+}
+
+// Watcher follows pairs created by a factory in real time. New pairs are received through a websocket
+// subscription, and pairs created while the subscription was down are backfilled with eth_getLogs.
+// Headers of blocks within the confirmation depth are tracked, so pairs of blocks dropped by a reorg
+// are rolled back and the blocks are scanned again.
+type Watcher struct {
+	exchange WatchDexExchange
+	provider contracts.Provider
+	url      string
+
+	// BlockRange is the maximum number of blocks requested per eth_getLogs call when backfilling
+	BlockRange uint64
+	// ReconnectDelay is the delay before the first reconnect, doubled on every failed attempt up to MaxReconnectDelay
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+	// Confirmations is the number of blocks after which a pair is final
+	Confirmations uint64
+	// PollInterval is how often the head is checked for reorgs and confirmations when no pair is created
+	PollInterval time.Duration
+	// Logger defaults to slog.Default
+	Logger *slog.Logger
+
+	// next is the first block not scanned yet
+	next uint64
+	// headers are the canonical headers of scanned blocks within the confirmation depth, oldest first
+	headers []*blockHeader
+	pending map[int64]*Pair
+	final   map[int64]bool
+}
+
+// NewWatcher creates a watcher of the exchange subscribing to new pairs at the websocket url.
+// Backfilling and pair calls go through the provider.
+func NewWatcher(exchange DexExchange, provider contracts.Provider, url string) (*Watcher, error) {
+	we, ok := exchange.(WatchDexExchange)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support watch mode", exchange)
+	}
+	return &Watcher{
+		exchange:          we,
+		provider:          provider,
+		url:               url,
+		BlockRange:        defaultLogBlockRange,
+		ReconnectDelay:    time.Second,
+		MaxReconnectDelay: time.Minute,
+		Confirmations:     12,
+		PollInterval:      15 * time.Second,
+		Logger:            slog.Default(),
+		pending:           map[int64]*Pair{},
+		final:             map[int64]bool{},
+	}, nil
+}
+
+// Watch calls handle with changes of the pairs created from block from on, until the context is done.
+// Pairs are read at the latest block.
+func (w *Watcher) Watch(ctx context.Context, from uint64, handle func(update *PairUpdate)) {
+	w.exchange.SetBlock(web3.Latest)
+	w.next = from
+	delay := w.ReconnectDelay
+	for {
+		connected, err := w.watch(ctx, handle)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if connected {
+			delay = w.ReconnectDelay
+		}
+		w.Logger.Error("Error watching pairs, reconnecting", "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > w.MaxReconnectDelay {
+			delay = w.MaxReconnectDelay
+		}
+	}
+}
+
+// watch subscribes to new pairs, backfills pairs created since the last scanned block and follows new
+// pairs until the subscription drops or the context is done. It reports whether the subscription was established.
+func (w *Watcher) watch(ctx context.Context, handle func(update *PairUpdate)) (bool, error) {
+	address, topic := w.exchange.PairCreatedFilter()
+	sub, err := subscribeLogs(ctx, w.url, address, topic)
+	if err != nil {
+		return false, err
+	}
+	defer sub.Close()
+
+	// logs are backfilled after subscribing, so no pair is created between the two
+	head, err := GetBlockNumber(ctx, w.provider)
+	if err != nil {
+		return true, err
+	}
+	if err := w.sync(ctx, head, handle); err != nil {
+		return true, err
+	}
+
+	w.Logger.Info("Watching pairs", "fromBlock", w.next)
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	for {
+		var to uint64
+		select {
+		case <-ctx.Done():
+			return true, nil
+		case l, ok := <-sub.Logs():
+			if !ok {
+				return true, fmt.Errorf("subscription dropped: %v", sub.Err())
+			}
+			to = l.BlockNumber
+			if l.Removed {
+				// the block was dropped by a reorg, only the blocks before it are certainly canonical
+				to--
+			}
+		case <-ticker.C:
+			if to, err = GetBlockNumber(ctx, w.provider); err != nil {
+				w.Logger.Error("Error getting head block", "error", err)
+				continue
+			}
+		}
+		if err := w.sync(ctx, to, handle); err != nil {
+			w.Logger.Error("Error syncing pairs", "toBlock", to, "error", err)
+		}
+	}
+}
+
+// sync follows the chain up to the block. Pending pairs of blocks dropped by a reorg are rolled back,
+// PairCreated logs of blocks not scanned yet are read and pairs with enough confirmations are finalized.
+func (w *Watcher) sync(ctx context.Context, to uint64, handle func(update *PairUpdate)) error {
+	update := &PairUpdate{Block: to}
+	defer func() {
+		if !update.empty() {
+			handle(update)
+		}
+	}()
+
+	if err := w.checkReorg(ctx, update); err != nil {
+		return err
+	}
+	if to >= w.next {
+		if err := w.scan(ctx, to, update); err != nil {
+			return err
+		}
+	}
+
+	for index, pair := range w.pending {
+		if pair.BlockNumber+w.Confirmations <= to {
+			pair.Pending = false
+			delete(w.pending, index)
+			w.final[index] = true
+			update.Finalized = append(update.Finalized, index)
+		}
+	}
+	for len(w.headers) > 1 && w.headers[0].Number+w.Confirmations < to {
+		w.headers = w.headers[1:]
+	}
+	return nil
+}
+
+// checkReorg compares the tracked headers with the canonical chain, newest first, and rolls back
+// pending pairs of blocks which are no longer canonical
+func (w *Watcher) checkReorg(ctx context.Context, update *PairUpdate) error {
+	reorged := false
+	for len(w.headers) > 0 {
+		last := w.headers[len(w.headers)-1]
+		canonical, err := getBlockHeader(ctx, w.provider, last.Number)
+		if err != nil {
+			return err
+		}
+		if canonical != nil && canonical.Hash == last.Hash {
+			break
+		}
+		w.Logger.Warn("Block was dropped by a reorg", "block", last.Number, "hash", last.Hash)
+		w.headers = w.headers[:len(w.headers)-1]
+		w.rollback(last.Number, update)
+		reorged = true
+	}
+	if reorged && len(w.headers) == 0 {
+		w.Logger.Error(
+			"Reorg is deeper than the confirmations, pairs marked final may be wrong",
+			"confirmations", w.Confirmations,
+		)
+	}
+	return nil
+}
+
+// rollback drops pending pairs created from the block on, and makes the block scanned again
+func (w *Watcher) rollback(block uint64, update *PairUpdate) {
+	for index, pair := range w.pending {
+		if pair.BlockNumber >= block {
+			w.Logger.Info("Rolling back pair", "pairIndex", index, "pairAddress", pair.Address, "block", pair.BlockNumber)
+			delete(w.pending, index)
+			update.Removed = append(update.Removed, index)
+		}
+	}
+	if block < w.next {
+		w.next = block
+	}
+}
+
+// maxScanAttempts is how many times blocks are scanned when the chain changes while they are read
+const maxScanAttempts = 3
+
+var errChainChanged = errors.New("chain changed while scanning")
+
+// scan adds pairs of PairCreated logs from the next block up to the block, and tracks headers of blocks
+// within the confirmation depth. Blocks are scanned again when the chain changes while they are read.
+func (w *Watcher) scan(ctx context.Context, to uint64, update *PairUpdate) error {
+	for attempt := 1; ; attempt++ {
+		err := w.scanBlocks(ctx, to, update)
+		if !errors.Is(err, errChainChanged) || attempt >= maxScanAttempts {
+			return err
+		}
+		w.Logger.Warn("Rescanning blocks", "fromBlock", w.next, "error", err)
+		if err := w.checkReorg(ctx, update); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *Watcher) scanBlocks(ctx context.Context, to uint64, update *PairUpdate) error {
+	start := w.next
+	if to > w.Confirmations && to-w.Confirmations > start {
+		start = to - w.Confirmations
+	}
+	// new headers have to follow the tracked ones, unless the tracked ones are out of the confirmation depth
+	var parent *blockHeader
+	if start > 0 {
+		parent = findHeader(w.headers, start-1)
+	}
+	var headers []*blockHeader
+	for number := start; number <= to; number++ {
+		header, err := getBlockHeader(ctx, w.provider, number)
+		if err != nil {
+			return err
+		}
+		if header == nil {
+			return fmt.Errorf("%w: block %d not found", errChainChanged, number)
+		}
+		if parent != nil && header.ParentHash != parent.Hash {
+			return fmt.Errorf("%w: parent of block %d is %s, not %s", errChainChanged, number, header.ParentHash, parent.Hash)
+		}
+		headers = append(headers, header)
+		parent = header
+	}
+
+	if w.next < start {
+		w.Logger.Info("Backfilling pairs", "fromBlock", w.next, "toBlock", to)
+	}
+	address, topic := w.exchange.PairCreatedFilter()
+	logs, err := scanLogs(ctx, w.provider, address, topic, w.next, to, w.BlockRange, w.Logger)
+	if err != nil {
+		return err
+	}
+	for _, l := range logs {
+		if h := findHeader(headers, l.BlockNumber); h != nil && h.Hash != l.BlockHash {
+			return fmt.Errorf("%w: log of block %d has hash %s, not %s", errChainChanged, l.BlockNumber, l.BlockHash, h.Hash)
+		}
+	}
+
+	// pairs which could not be fetched because the watch stopped are not skipped, the blocks stay unscanned
+	pairs, failedBlock, failed := w.getPairs(ctx, logs)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// tracked headers of blocks scanned again are replaced by the new ones
+	for len(w.headers) > 0 && w.headers[len(w.headers)-1].Number >= start {
+		w.headers = w.headers[:len(w.headers)-1]
+	}
+	if len(w.headers) > 0 && (len(headers) == 0 || w.headers[len(w.headers)-1].Number+1 != headers[0].Number) {
+		w.headers = nil
+	}
+	w.headers = append(w.headers, headers...)
+	for _, pair := range pairs {
+		pair.Pending = pair.BlockNumber+w.Confirmations > to
+		if pair.Pending {
+			w.pending[pair.Index] = pair
+		} else {
+			w.final[pair.Index] = true
+		}
+		update.Added = append(update.Added, pair)
+	}
+	w.next = to + 1
+	if failed {
+		// pairs which could not be fetched are fetched again by the next sync, which scans their blocks again
+		w.next = failedBlock
+	}
+	return nil
+}
+
+// findHeader returns the header of the block
+func findHeader(headers []*blockHeader, number uint64) *blockHeader {
+	for _, h := range headers {
+		if h.Number == number {
+			return h
+		}
+	}
+	return nil
+}
+
+// getPairs returns the pairs announced by the logs which are not known yet, with the block they were created in.
+// If some pairs could not be fetched, it also returns the earliest block of such a pair.
+func (w *Watcher) getPairs(ctx context.Context, logs []*web3.Log) ([]*Pair, uint64, bool) {
+	var indices []int64
+	created := map[int64]*web3.Log{}
+	for _, l := range logs {
+		if l.Removed {
+			continue
+		}
+		event, err := w.exchange.ParsePairCreated(l)
+		if err != nil {
+			w.Logger.Error("Error parsing PairCreated log", "tx", l.TransactionHash, "error", err)
+			continue
+		}
+		if _, ok := w.pending[event.Index]; ok || w.final[event.Index] || created[event.Index] != nil {
+			continue
+		}
+		created[event.Index] = l
+		indices = append(indices, event.Index)
+	}
+	if len(indices) == 0 {
+		return nil, 0, false
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	var pairs []*Pair
+	var errs []error
+	// index returns the pair index of the i-th result
+	index := func(i int) int64 { return indices[i] }
+	if b, ok := w.exchange.(BatchDexExchange); ok {
+		pairs, errs = b.GetPairs(ctx, indices[0], indices[len(indices)-1]+1)
+		index = func(i int) int64 { return indices[0] + int64(i) }
+	} else {
+		pairs = make([]*Pair, len(indices))
+		errs = make([]error, len(indices))
+		for i, n := range indices {
+			pairs[i], errs[i] = w.exchange.GetPair(ctx, n)
+		}
+	}
+
+	var found []*Pair
+	var failedBlock uint64
+	failed := false
+	for i, pair := range pairs {
+		if errs[i] != nil {
+			l := created[index(i)]
+			if l == nil {
+				continue
+			}
+			w.Logger.Error("Error getting new pair", "pairIndex", index(i), "block", l.BlockNumber, "error", errs[i])
+			if !failed || l.BlockNumber < failedBlock {
+				failedBlock = l.BlockNumber
+			}
+			failed = true
+			continue
+		}
+		if pair == nil || created[pair.Index] == nil {
+			continue
+		}
+		pair.BlockNumber = created[pair.Index].BlockNumber
+		pair.BlockHash = strings.ToLower(created[pair.Index].BlockHash.String())
+		found = append(found, pair)
+	}
+	w.Logger.Info("Got new pairs", "pairs", len(found))
+	return found, failedBlock, failed
+}
@@ -0,0 +1,329 @@
+package dex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"golang.org/x/exp/slog"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var (
+	testFactory     = web3.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f")
+	testPairCreated = web3.HexToHash("0x0d3648bd0f6ba80134a33ba9275ac585d9d315f0ad8355cddefde31afa28d0e9")
+)
+
+// testWatchExchange is an exchange whose PairCreated logs hold the pair index as data
+type testWatchExchange struct {
+	m sync.Mutex
+	// failures is how many more times getting the pair at the index fails
+	failures map[int64]int
+}
+
+func (e *testWatchExchange) GetPair(ctx context.Context, n int64) (*Pair, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.failures[n] > 0 {
+		e.failures[n]--
+		return nil, &rpcError{Code: -32000, Message: "header not found"}
+	}
+	return &Pair{Index: n, Address: fmt.Sprintf("pair%d", n)}, nil
+}
+
+func (e *testWatchExchange) GetPairNumber(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(0), nil
+}
+
+func (e *testWatchExchange) SetBlock(block web3.BlockNumber) {}
+
+func (e *testWatchExchange) SetSanitizePolicy(policy SanitizePolicy) {}
+
+func (e *testWatchExchange) SetLogger(logger *slog.Logger) {}
+
+func (e *testWatchExchange) PairCreatedFilter() (web3.Address, web3.Hash) {
+	return testFactory, testPairCreated
+}
+
+func (e *testWatchExchange) ParsePairCreated(log *web3.Log) (*contracts.PairCreatedEvent, error) {
+	return &contracts.PairCreatedEvent{Index: new(big.Int).SetBytes(log.Data).Int64()}, nil
+}
+
+// testChain is a chain of blocks announcing pairs, which can be reorged
+type testChain struct {
+	m      sync.Mutex
+	fork   byte
+	blocks []testBlock
+}
+
+type testBlock struct {
+	hash  web3.Hash
+	pairs []int64
+}
+
+func newTestChain(head uint64) *testChain {
+	c := &testChain{}
+	c.extend(head)
+	return c
+}
+
+// extend adds blocks of the current fork up to head
+func (c *testChain) extend(head uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for n := uint64(len(c.blocks)); n <= head; n++ {
+		var hash web3.Hash
+		hash[0] = c.fork
+		big.NewInt(int64(n)).FillBytes(hash[24:])
+		c.blocks = append(c.blocks, testBlock{hash: hash})
+	}
+}
+
+// reorg drops the blocks from the block on, and extends the chain up to head with blocks of a new fork
+func (c *testChain) reorg(block uint64, head uint64) {
+	c.m.Lock()
+	c.blocks = c.blocks[:block]
+	c.fork++
+	c.m.Unlock()
+	c.extend(head)
+}
+
+func (c *testChain) addPair(block uint64, index int64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.blocks[block].pairs = append(c.blocks[block].pairs, index)
+}
+
+func (c *testChain) getBlock(params []json.RawMessage) (interface{}, error) {
+	n, err := parseQuantity(params[0])
+	if err != nil {
+		return nil, err
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if n >= uint64(len(c.blocks)) {
+		return nil, nil
+	}
+	header := map[string]interface{}{
+		"number":     fmt.Sprintf("0x%x", n),
+		"hash":       c.blocks[n].hash.String(),
+		"parentHash": web3.Hash{}.String(),
+	}
+	if n > 0 {
+		header["parentHash"] = c.blocks[n-1].hash.String()
+	}
+	return header, nil
+}
+
+func (c *testChain) getLogs(params []json.RawMessage) (interface{}, error) {
+	var filter struct {
+		FromBlock json.RawMessage `json:"fromBlock"`
+		ToBlock   json.RawMessage `json:"toBlock"`
+	}
+	if err := json.Unmarshal(params[0], &filter); err != nil {
+		return nil, err
+	}
+	from, err := parseQuantity(filter.FromBlock)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseQuantity(filter.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	logs := []*web3.Log{}
+	for n := from; n <= to && n < uint64(len(c.blocks)); n++ {
+		for _, index := range c.blocks[n].pairs {
+			logs = append(logs, &web3.Log{
+				Address:     testFactory,
+				Topics:      []web3.Hash{testPairCreated},
+				Data:        big.NewInt(index).Bytes(),
+				BlockNumber: n,
+				BlockHash:   c.blocks[n].hash,
+			})
+		}
+	}
+	return logs, nil
+}
+
+func (c *testChain) hash(block uint64) string {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return strings.ToLower(c.blocks[block].hash.String())
+}
+
+func addedIndices(update *PairUpdate) []int64 {
+	var indices []int64
+	for _, pair := range update.Added {
+		indices = append(indices, pair.Index)
+	}
+	return indices
+}
+
+func sortedIndices(indices []int64) []int64 {
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+	return indices
+}
+
+func TestWatcherRollsBackReorgedPairs(t *testing.T) {
+	chain := newTestChain(10)
+	chain.addPair(9, 0)
+	chain.addPair(10, 1)
+	node := newTestNode(t, map[string]rpcHandler{
+		"eth_getBlockByNumber": chain.getBlock,
+		"eth_getLogs":          chain.getLogs,
+	})
+	w, err := NewWatcher(&testWatchExchange{}, NewHTTPTransport(node.URL), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Confirmations = 3
+	w.next = 5
+	ctx := context.Background()
+	var update *PairUpdate
+	handle := func(u *PairUpdate) { update = u }
+
+	// both pairs are pending at block 10
+	if err := w.sync(ctx, 10, handle); err != nil {
+		t.Fatal(err)
+	}
+	if update == nil || !reflect.DeepEqual(addedIndices(update), []int64{0, 1}) {
+		t.Fatalf("expected pairs 0 and 1 added, got %+v", update)
+	}
+	for _, pair := range update.Added {
+		if !pair.Pending || pair.BlockHash != chain.hash(pair.BlockNumber) {
+			t.Errorf("unexpected pair %+v", pair)
+		}
+	}
+
+	// block 10 is dropped and pair 1 is created again in block 11 of the new fork
+	chain.reorg(10, 11)
+	chain.addPair(11, 1)
+	update = nil
+	if err := w.sync(ctx, 11, handle); err != nil {
+		t.Fatal(err)
+	}
+	if update == nil || !reflect.DeepEqual(update.Removed, []int64{1}) {
+		t.Fatalf("expected pair 1 removed, got %+v", update)
+	}
+	if !reflect.DeepEqual(addedIndices(update), []int64{1}) {
+		t.Fatalf("expected pair 1 added again, got %+v", update.Added)
+	}
+	if pair := update.Added[0]; pair.BlockNumber != 11 || pair.BlockHash != chain.hash(11) || !pair.Pending {
+		t.Errorf("unexpected pair %+v", pair)
+	}
+
+	// both pairs have 3 confirmations at block 14
+	chain.extend(14)
+	update = nil
+	if err := w.sync(ctx, 14, handle); err != nil {
+		t.Fatal(err)
+	}
+	if update == nil || len(update.Added) != 0 || len(update.Removed) != 0 ||
+		!reflect.DeepEqual(sortedIndices(update.Finalized), []int64{0, 1}) {
+		t.Fatalf("expected pairs 0 and 1 finalized, got %+v", update)
+	}
+}
+
+func TestWatcherKeepsFinalPairsOnReorg(t *testing.T) {
+	chain := newTestChain(10)
+	chain.addPair(5, 0)
+	node := newTestNode(t, map[string]rpcHandler{
+		"eth_getBlockByNumber": chain.getBlock,
+		"eth_getLogs":          chain.getLogs,
+	})
+	w, err := NewWatcher(&testWatchExchange{}, NewHTTPTransport(node.URL), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Confirmations = 3
+	ctx := context.Background()
+	var update *PairUpdate
+	handle := func(u *PairUpdate) { update = u }
+
+	if err := w.sync(ctx, 10, handle); err != nil {
+		t.Fatal(err)
+	}
+	if update == nil || len(update.Added) != 1 || update.Added[0].Pending {
+		t.Fatalf("expected final pair 0 added, got %+v", update)
+	}
+
+	// a reorg within the confirmation depth leaves pairs of older blocks alone
+	chain.reorg(9, 11)
+	update = nil
+	if err := w.sync(ctx, 11, handle); err != nil {
+		t.Fatal(err)
+	}
+	if update != nil {
+		t.Fatalf("expected no update, got %+v", update)
+	}
+	if w.next != 12 {
+		t.Errorf("expected blocks up to 11 scanned, next block is %d", w.next)
+	}
+}
+
+func TestWatcherRetriesFailedPairs(t *testing.T) {
+	chain := newTestChain(10)
+	chain.addPair(6, 0)
+	chain.addPair(7, 1)
+	chain.addPair(9, 2)
+	node := newTestNode(t, map[string]rpcHandler{
+		"eth_getBlockByNumber": chain.getBlock,
+		"eth_getLogs":          chain.getLogs,
+	})
+	w, err := NewWatcher(&testWatchExchange{failures: map[int64]int{1: 1}}, NewHTTPTransport(node.URL), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Logger = testLogger
+	w.Confirmations = 3
+	w.next = 5
+	ctx := context.Background()
+	var update *PairUpdate
+	handle := func(u *PairUpdate) { update = u }
+
+	// pair 1 fails, its block stays unscanned
+	if err := w.sync(ctx, 10, handle); err != nil {
+		t.Fatal(err)
+	}
+	if update == nil || !reflect.DeepEqual(addedIndices(update), []int64{0, 2}) {
+		t.Fatalf("expected pairs 0 and 2 added, got %+v", update)
+	}
+	if w.next != 7 {
+		t.Errorf("expected block 7 of pair 1 to be scanned again, next block is %d", w.next)
+	}
+
+	// the next sync adds pair 1 and leaves the pairs added before alone
+	chain.extend(11)
+	update = nil
+	if err := w.sync(ctx, 11, handle); err != nil {
+		t.Fatal(err)
+	}
+	if update == nil || !reflect.DeepEqual(addedIndices(update), []int64{1}) {
+		t.Fatalf("expected pair 1 added, got %+v", update)
+	}
+	if pair := update.Added[0]; pair.BlockNumber != 7 || pair.BlockHash != chain.hash(7) || pair.Pending {
+		t.Errorf("unexpected pair %+v", pair)
+	}
+	if w.next != 12 {
+		t.Errorf("expected blocks up to 11 scanned, next block is %d", w.next)
+	}
+
+	// headers of the blocks scanned again are still tracked, so a reorg rolls back pair 2
+	chain.reorg(9, 12)
+	update = nil
+	if err := w.sync(ctx, 12, handle); err != nil {
+		t.Fatal(err)
+	}
+	if update == nil || !reflect.DeepEqual(update.Removed, []int64{2}) {
+		t.Fatalf("expected pair 2 removed, got %+v", update)
+	}
+}
@@ -0,0 +1,366 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/nikolalosic/dex-pairs/dex"
+	"github.com/nikolalosic/dex-pairs/metrics"
+	"github.com/nikolalosic/dex-pairs/store"
+	"github.com/umbracle/go-web3"
+	"golang.org/x/exp/slog"
+	"strings"
+	"time"
+)
+
+// ErrInterrupted is returned when the context of an export is cancelled
+var ErrInterrupted = errors.New("export interrupted")
+
+// ErrTimeout is returned when the deadline of the context of an export is exceeded
+var ErrTimeout = errors.New("export timed out")
+
+// PairError is returned when a pair fails on the node and Options.FailFast is set
+type PairError struct {
+	Index int64
+	Class dex.ErrorClass
+	Err   error
+}
+
+func (e *PairError) Error() string {
+	return fmt.Sprintf("pair %d: %s", e.Index, e.Err.Error())
+}
+
+func (e *PairError) Unwrap() error {
+	return e.Err
+}
+
+// Options configures an Exporter
+type Options struct {
+	// Dex and Version select the DEX in the registry, e.g. uniswap and 2
+	Dex     string
+	Version int
+	ChainId int
+	// Registry holds the DEX deployments, nil uses the built-in ones
+	Registry *dex.Registry
+	Provider dex.ProviderConfig
+	// Store keeps the exported pairs and is not closed by the exporter
+	Store store.Store
+	// Concurrency is the number of jobs fetched at the same time, at least 1
+	Concurrency int
+	// BatchMode is either multicall, the default, or jsonrpc. BatchSize 0 disables batching.
+	BatchMode        string
+	BatchSize        int
+	MulticallAddress web3.Address
+	// pairs are saved to the store after CheckpointJobs completed jobs, unless it is 0,
+	// and every CheckpointInterval, which defaults to a minute
+	CheckpointJobs     int
+	CheckpointInterval time.Duration
+	// State adds the state of every pair at the export block
+	State bool
+	// Block is the block every call is made at. 0 pins an unfinished export in the store to the block it
+	// started at, and any other export to the latest block minus Confirmations.
+	Block         uint64
+	Confirmations uint64
+	// SanitizePolicy of token symbols and names, nil uses dex.DefaultSanitizePolicy
+	SanitizePolicy *dex.SanitizePolicy
+	// FailFast stops the export with a PairError on the first pair failing on the node
+	FailFast bool
+	// WatchURL is the websocket node URL Watch follows new pairs on
+	WatchURL           string
+	WatchConfirmations uint64
+	// Logger defaults to slog.Default. Records of the exporter, the DEX and the provider get dex and chain
+	// attributes. The provider logs through Provider.Logger instead when it is set.
+	Logger *slog.Logger
+	// Progress, if set, is called after every completed job, every ProgressInterval and once the jobs are done
+	Progress         func(p Progress)
+	ProgressInterval time.Duration
+}
+
+// Result of an export
+type Result struct {
+	Dataset   store.Dataset
+	Block     uint64
+	BlockHash string
+	// PairCount is the number of pairs of the factory at Block
+	PairCount int
+	// Pairs are all pairs of the dataset, ordered by their factory index
+	Pairs []dex.Pair
+	// Fetched is the number of pairs fetched by the export
+	Fetched  int
+	Failures []store.Failure
+}
+
+// Exporter exports the pairs of a DEX to a store. It is not safe for concurrent use.
+type Exporter struct {
+	opts     Options
+	provider contracts.Provider
+	exchange dex.DexExchange
+	watcher  *dex.Watcher
+	ds       store.Dataset
+
+	// fetched are all pairs of the dataset, unsaved those changed since they were last saved to the store
+	fetched map[int64]dex.Pair
+	unsaved map[int64]dex.Pair
+	removed []int64
+	cursor  store.Cursor
+	tracker *tracker
+	logger  *slog.Logger
+}
+
+// New creates an exporter, opening the rpc provider and the DEX
+func New(opts Options) (*Exporter, error) {
+	if opts.Store == nil {
+		return nil, errors.New("store is not set")
+	}
+	if opts.Registry == nil {
+		opts.Registry = dex.NewRegistry()
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.CheckpointInterval <= 0 {
+		opts.CheckpointInterval = time.Minute
+	}
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = time.Second
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	ds := store.Dataset{ChainId: opts.ChainId, Dex: fmt.Sprintf("%s_v%d", strings.ToLower(opts.Dex), opts.Version)}
+	logger := opts.Logger.With("dex", ds.Dex, "chain", ds.ChainId)
+	if opts.Provider.Logger == nil {
+		opts.Provider.Logger = logger
+	}
+	provider, err := dex.NewProvider(opts.Provider)
+	if err != nil {
+		logger.Error("Error opening rpc provider", "error", err)
+		return nil, err
+	}
+	exchange, err := opts.Registry.NewDex(opts.Dex, opts.ChainId, opts.Version, provider)
+	if err != nil {
+		logger.Error("Cannot get DEX", "error", err)
+		return nil, err
+	}
+	exchange.SetLogger(logger)
+	if opts.SanitizePolicy != nil {
+		exchange.SetSanitizePolicy(*opts.SanitizePolicy)
+	}
+	if bd, ok := exchange.(dex.BatchDexExchange); ok && opts.BatchSize > 0 {
+		switch opts.BatchMode {
+		case "", "multicall":
+			address := opts.MulticallAddress
+			if address == (web3.Address{}) {
+				address = dex.DefaultMulticallAddress
+			}
+			bd.EnableMulticall(address, opts.BatchSize)
+		case "jsonrpc":
+			bd.EnableBatchTransport(opts.BatchSize)
+		default:
+			return nil, fmt.Errorf("unknown batch mode %s", opts.BatchMode)
+		}
+	}
+	if _, ok := exchange.(dex.StateDexExchange); opts.State && !ok {
+		return nil, fmt.Errorf("state mode is not supported by %s V%d", opts.Dex, opts.Version)
+	}
+	e := &Exporter{
+		opts:     opts,
+		provider: provider,
+		exchange: exchange,
+		ds:       ds,
+		logger:   logger,
+	}
+	if opts.WatchURL != "" {
+		e.watcher, err = dex.NewWatcher(exchange, provider, opts.WatchURL)
+		if err != nil {
+			logger.Error("Error creating watcher", "error", err)
+			return nil, err
+		}
+		e.watcher.Confirmations = opts.WatchConfirmations
+		e.watcher.Logger = logger
+	}
+	return e, nil
+}
+
+// Dataset is the dataset of the store the pairs are exported to
+func (e *Exporter) Dataset() store.Dataset {
+	return e.ds
+}
+
+// Pairs returns all pairs of the dataset ordered by their factory index, nil before Export
+func (e *Exporter) Pairs() []dex.Pair {
+	if e.fetched == nil {
+		return nil
+	}
+	return sortedPairs(e.fetched)
+}
+
+// Export fetches the pairs missing from the store at the export block and saves them to the store.
+// When the export is stopped by the context or a PairError, the pairs fetched so far are saved and
+// the partial result is returned with ErrInterrupted, ErrTimeout or the PairError.
+func (e *Exporter) Export(ctx context.Context) (*Result, error) {
+	st := e.opts.Store
+	e.logger.Info("Reading pairs from store")
+	loaded, err := st.Load(e.ds)
+	if err != nil {
+		e.logger.Error("Error reading pairs from store", "error", err)
+		return nil, err
+	}
+	e.fetched = map[int64]dex.Pair{}
+	for _, pair := range loaded {
+		e.fetched[pair.Index] = pair
+	}
+	if len(e.fetched) < len(loaded) {
+		e.logger.Warn(
+			"Store has pairs with duplicate indices, keeping the last of each", "duplicates", len(loaded)-len(e.fetched),
+		)
+	}
+	e.unsaved = map[int64]dex.Pair{}
+	e.removed = dropPendingPairs(e.fetched)
+	cursor, err := st.Cursor(e.ds)
+	if err != nil {
+		e.logger.Error("Error reading cursor from store", "error", err)
+		return nil, err
+	}
+	block, err := getExportBlock(ctx, e.provider, e.opts.Block, e.opts.Confirmations, e.fetched, cursor)
+	if err != nil {
+		e.logger.Error("Error getting export block", "error", err)
+		return nil, err
+	}
+	blockHash, err := dex.GetBlockHash(ctx, e.provider, block)
+	if err != nil {
+		e.logger.Error("Error getting block hash", "block", block, "error", err)
+		return nil, err
+	}
+	// pairs of a resumed export were read at the block of the cursor, which the node has to serve unchanged
+	if len(e.fetched) > 0 && cursor != nil && cursor.Block == block && cursor.Hash != "" &&
+		cursor.Hash != blockHash.String() {
+		err := fmt.Errorf("block %d of the stored pairs has hash %s, the node has %s", block, cursor.Hash, blockHash)
+		e.logger.Error("Error resuming export", "error", err)
+		return nil, err
+	}
+	e.logger.Info("Exporting pairs", "block", block, "hash", blockHash.String())
+	e.exchange.SetBlock(web3.BlockNumber(block))
+	e.cursor = store.Cursor{Block: block, Hash: blockHash.String()}
+	var stateBlock uint64
+	if e.opts.State {
+		stateBlock = block
+		e.removed = append(e.removed, dropStaleStates(e.fetched, block)...)
+	}
+	pn, err := e.exchange.GetPairNumber(ctx)
+	if err != nil {
+		e.logger.Error("Error getting all pairs length", "error", err)
+		return nil, err
+	}
+	res := &Result{Dataset: e.ds, Block: block, BlockHash: blockHash.String(), PairCount: int(pn.Int64())}
+	pendingJobs := getMissingJobs(e.fetched, res.PairCount, jobSize)
+	e.logger.Info(
+		"Planned jobs", "pairCount", res.PairCount, "fetched", len(e.fetched), "step", jobSize, "jobs", len(pendingJobs),
+	)
+	if len(pendingJobs) == 0 {
+		e.logger.Info("No jobs to run")
+		e.cursor.Complete = true
+		if err := e.savePairs(); err != nil {
+			return nil, err
+		}
+		res.Pairs = e.Pairs()
+		return res, nil
+	}
+
+	failures, fetched, cause, err := e.runJobs(ctx, pendingJobs, stateBlock)
+	if err != nil {
+		return nil, err
+	}
+	res.Fetched = fetched
+	res.Failures = sortedFailures(failures)
+	if cause != nil {
+		e.logger.Warn("Export stopped, saving fetched pairs", "pairs", len(e.fetched), "reason", cause.Error())
+	} else {
+		e.logger.Info("Completed getting pairs", "fetched", fetched, "failed", len(failures))
+		// failed pairs are fetched again by the next export, at a newer block
+		e.cursor.Complete = true
+	}
+	if err := e.savePairs(); err != nil {
+		return nil, err
+	}
+	if err := st.SaveFailures(e.ds, res.Failures); err != nil {
+		e.logger.Error("Error saving failures to store", "error", err)
+		return nil, err
+	}
+	res.Pairs = e.Pairs()
+	return res, cause
+}
+
+// Watch follows pairs created after the exported block until the context is done, saving them to the store.
+// handle, if set, is called after every saved update.
+func (e *Exporter) Watch(ctx context.Context, handle func(update *dex.PairUpdate)) error {
+	if e.watcher == nil {
+		return errors.New("watch URL is not set")
+	}
+	if e.fetched == nil {
+		return errors.New("pairs are not exported")
+	}
+	e.watcher.Watch(ctx, e.cursor.Block+1, func(update *dex.PairUpdate) {
+		e.logger.Info(
+			"Saving watched pairs", "block", update.Block, "added", len(update.Added), "removed", len(update.Removed),
+			"finalized", len(update.Finalized),
+		)
+		for _, index := range update.Removed {
+			delete(e.fetched, index)
+			delete(e.unsaved, index)
+			e.removed = append(e.removed, index)
+		}
+		for _, pair := range update.Added {
+			e.fetched[pair.Index] = *pair
+			e.unsaved[pair.Index] = *pair
+		}
+		metrics.AddPairs(e.ds.Dex, e.ds.ChainId, len(update.Added))
+		for _, index := range update.Finalized {
+			if pair, ok := e.fetched[index]; ok {
+				pair.Pending = false
+				e.fetched[index] = pair
+				e.unsaved[index] = pair
+			}
+		}
+		if hash, err := dex.GetBlockHash(ctx, e.provider, update.Block); err == nil {
+			e.cursor = store.Cursor{Block: update.Block, Hash: hash.String(), Complete: e.cursor.Complete}
+		}
+		if err := e.savePairs(); err != nil {
+			e.logger.Error("Error saving watched pairs", "error", err)
+		}
+		if handle != nil {
+			handle(update)
+		}
+	})
+	e.logger.Info("Stopped watching pairs")
+	return nil
+}
+
+// savePairs saves changed and removed pairs and the export block to the store
+func (e *Exporter) savePairs() error {
+	st := e.opts.Store
+	e.logger.Info("Saving pairs to store", "changed", len(e.unsaved), "removed", len(e.removed))
+	if err := st.SetCursor(e.ds, e.cursor); err != nil {
+		e.logger.Error("Error saving cursor to store", "error", err)
+		return err
+	}
+	if err := st.RemovePairs(e.ds, e.removed); err != nil {
+		e.logger.Error("Error removing pairs from store", "error", err)
+		return err
+	}
+	if err := st.UpsertPairs(e.ds, sortedPairs(e.unsaved)); err != nil {
+		e.logger.Error("Error saving pairs to store", "error", err)
+		return err
+	}
+	e.unsaved = map[int64]dex.Pair{}
+	e.removed = nil
+	lastIndex := int64(-1)
+	for index := range e.fetched {
+		if index > lastIndex {
+			lastIndex = index
+		}
+	}
+	metrics.SetSynced(e.ds.Dex, e.ds.ChainId, lastIndex, e.cursor.Block)
+	return nil
+}
@@ -0,0 +1,171 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"github.com/nikolalosic/dex-pairs/dex"
+	"github.com/nikolalosic/dex-pairs/store"
+	"github.com/umbracle/go-web3"
+	"golang.org/x/exp/slog"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var (
+	testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	testWETH   = web3.HexToAddress("0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2")
+	testUSDC   = web3.HexToAddress("0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48")
+	testDAI    = web3.HexToAddress("0x6b175474e89094c44da98b954eedeac495271d0f")
+)
+
+// newTestExporter creates an exporter of the built-in Uniswap V2 deployment with minimal options
+func newTestExporter(t *testing.T, url string, st store.Store) *Exporter {
+	ex, err := New(Options{
+		Dex:      "uniswap",
+		Version:  2,
+		ChainId:  1,
+		Provider: dex.ProviderConfig{Endpoints: []dex.Endpoint{{URL: url}}},
+		Store:    st,
+		Logger:   testLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ex
+}
+
+func newTestStore(t *testing.T) store.Store {
+	path := filepath.Join(t.TempDir(), "pairs.json")
+	st := store.NewJSONFile(path, path, testLogger)
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestExport(t *testing.T) {
+	chain := newTestChain(100)
+	chain.addToken(testWETH, "WETH", "Wrapped Ether", 18)
+	chain.addToken(testUSDC, "USDC", "USD Coin", 6)
+	chain.addToken(testDAI, "DAI", "Dai Stablecoin", 18)
+	chain.addPair(testUSDC, testWETH)
+	chain.addPair(testDAI, testWETH)
+	node := newTestNode(t, chain)
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	res, err := newTestExporter(t, node.URL, st).Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Block != 100 || res.BlockHash != blockHash(100).String() || res.PairCount != 2 || res.Fetched != 2 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if len(res.Pairs) != 2 || len(res.Failures) != 0 {
+		t.Fatalf("expected 2 pairs and no failures, got %+v", res)
+	}
+	if res.Pairs[0].Name != "Uniswap V2 - USDC/WETH" || res.Pairs[1].Name != "Uniswap V2 - DAI/WETH" {
+		t.Errorf("unexpected pair names %s and %s", res.Pairs[0].Name, res.Pairs[1].Name)
+	}
+	if token := res.Pairs[0].Token0Info; token == nil || token.Symbol != "USDC" || token.Decimals != 6 {
+		t.Errorf("unexpected token0 %+v", token)
+	}
+	cursor, err := st.Cursor(res.Dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor == nil || cursor.Block != 100 || !cursor.Complete {
+		t.Errorf("expected complete export at block 100, got %+v", cursor)
+	}
+
+	// the next run moves on to the latest block and fetches only the pair created since
+	chain.addPair(testDAI, testUSDC)
+	chain.setHead(110)
+	res, err = newTestExporter(t, node.URL, st).Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Block != 110 || res.PairCount != 3 || res.Fetched != 1 || len(res.Pairs) != 3 {
+		t.Fatalf("unexpected result of the second run %+v", res)
+	}
+	if res.Pairs[2].Name != "Uniswap V2 - DAI/USDC" {
+		t.Errorf("unexpected pair name %s", res.Pairs[2].Name)
+	}
+}
+
+func TestExportFailures(t *testing.T) {
+	chain := newTestChain(100)
+	chain.addToken(testWETH, "WETH", "Wrapped Ether", 18)
+	chain.addToken(testUSDC, "USDC", "USD Coin", 6)
+	chain.addPair(testUSDC, testWETH)
+	chain.addPair(testUSDC, testWETH)
+	chain.fail[1] = &rpcError{Code: -32000, Message: "header not found"}
+	node := newTestNode(t, chain)
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	ex, err := New(Options{
+		Dex:     "uniswap",
+		Version: 2,
+		ChainId: 1,
+		Provider: dex.ProviderConfig{
+			Endpoints: []dex.Endpoint{{URL: node.URL}},
+			Retry:     dex.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		},
+		Store:  st,
+		Logger: testLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ex.Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Pairs) != 1 || len(res.Failures) != 1 {
+		t.Fatalf("expected 1 pair and 1 failure, got %+v", res)
+	}
+	if f := res.Failures[0]; f.Index != 1 || f.Class != dex.ErrorClassRetryable.String() {
+		t.Errorf("unexpected failure %+v", f)
+	}
+
+	// with FailFast the failing pair stops the export
+	ex, err = New(Options{
+		Dex:     "uniswap",
+		Version: 2,
+		ChainId: 1,
+		Provider: dex.ProviderConfig{
+			Endpoints: []dex.Endpoint{{URL: node.URL}},
+			Retry:     dex.RetryPolicy{MaxAttempts: 1},
+		},
+		Store:    newTestStore(t),
+		FailFast: true,
+		Logger:   testLogger,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ex.Export(ctx)
+	var pairErr *PairError
+	if !errors.As(err, &pairErr) || pairErr.Index != 1 {
+		t.Errorf("expected error of pair 1, got %v", err)
+	}
+
+	// the next run fetches only the failed pair
+	chain.m.Lock()
+	delete(chain.fail, 1)
+	chain.m.Unlock()
+	res, err = newTestExporter(t, node.URL, st).Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Fetched != 1 || len(res.Pairs) != 2 || len(res.Failures) != 0 {
+		t.Fatalf("expected failed pair fetched again, got %+v", res)
+	}
+}
+
+func TestNewRequiresStore(t *testing.T) {
+	if _, err := New(Options{Dex: "uniswap", Version: 2, ChainId: 1}); err == nil {
+		t.Error("expected error without a store")
+	}
+}
@@ -0,0 +1,302 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/nikolalosic/dex-pairs/dex"
+	"github.com/nikolalosic/dex-pairs/metrics"
+	"github.com/nikolalosic/dex-pairs/store"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jobSize is the maximum number of pairs of a job
+const jobSize = 300
+
+type job struct {
+	start int
+	end   int
+}
+
+type result struct {
+	pairs    []dex.Pair
+	failures []store.Failure
+	err      error
+}
+
+// runJobs fetches the pairs of the jobs, checkpointing them to the store, and returns failures and the
+// number of fetched pairs. cause is set when the jobs were cancelled, err when saving pairs failed.
+func (e *Exporter) runJobs(
+	ctx context.Context, pendingJobs []job, stateBlock uint64,
+) (failures map[int64]store.Failure, fetched int, cause error, err error) {
+	cores := e.opts.Concurrency
+	if len(pendingJobs) < cores {
+		cores = len(pendingJobs)
+	}
+	jobs := make(chan job, cores)
+	results := make(chan result)
+
+	// the tracker is set before any worker adds to it
+	total := 0
+	for _, j := range pendingJobs {
+		total += j.end - j.start
+	}
+	e.tracker = newTracker(total)
+
+	// jobs are cancelled on signal, timeout or the first fatal error
+	jobCtx, cancelJobs := context.WithCancel(ctx)
+	defer cancelJobs()
+	var fatalErr error
+	var workers sync.WaitGroup
+	metrics.AddQueuedJobs(e.ds.Dex, e.ds.ChainId, len(pendingJobs))
+	for i := 0; i < cores; i++ {
+		workers.Add(1)
+		go func(js <-chan job, rs chan<- result) {
+			defer workers.Done()
+			for j := range js {
+				metrics.AddQueuedJobs(e.ds.Dex, e.ds.ChainId, -1)
+				// jobs left once the export is cancelled are drained without being run
+				if jobCtx.Err() != nil {
+					continue
+				}
+				metrics.AddBusyWorkers(e.ds.Dex, e.ds.ChainId, 1)
+				pairs, failures, err := e.getPairs(jobCtx, j.start, j.end, stateBlock)
+				metrics.AddBusyWorkers(e.ds.Dex, e.ds.ChainId, -1)
+				rs <- result{err: err, pairs: pairs, failures: failures}
+			}
+		}(jobs, results)
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+	go func() {
+		for _, j := range pendingJobs {
+			jobs <- j
+		}
+		close(jobs)
+	}()
+
+	failures = map[int64]store.Failure{}
+	checkpointTicker := time.NewTicker(e.opts.CheckpointInterval)
+	defer checkpointTicker.Stop()
+	progressTicker := time.NewTicker(e.opts.ProgressInterval)
+	defer progressTicker.Stop()
+
+	sinceCheckpoint := 0
+	// results are read until every worker is done, so pairs of jobs running when the export is cancelled are kept
+	for i, running := 0, true; running; {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				running = false
+				continue
+			}
+			i++
+			for _, pair := range r.pairs {
+				e.fetched[pair.Index] = pair
+				e.unsaved[pair.Index] = pair
+			}
+			for _, f := range r.failures {
+				failures[f.Index] = f
+			}
+			fetched += len(r.pairs)
+			e.reportProgress()
+			if r.err != nil && fatalErr == nil {
+				e.logger.Error("Cancelling export on fatal error", "error", r.err)
+				fatalErr = r.err
+				cancelJobs()
+			}
+			sinceCheckpoint++
+			if e.opts.CheckpointJobs <= 0 || sinceCheckpoint < e.opts.CheckpointJobs || i == len(pendingJobs) {
+				continue
+			}
+		case <-checkpointTicker.C:
+			if sinceCheckpoint == 0 {
+				continue
+			}
+		case <-progressTicker.C:
+			e.reportProgress()
+			continue
+		}
+		e.logger.Info("Checkpointing fetched pairs", "pairs", len(e.fetched))
+		if err := e.savePairs(); err != nil {
+			// workers are stopped and their results discarded, so none is left blocked on results
+			cancelJobs()
+			for range results {
+			}
+			return nil, 0, nil, err
+		}
+		sinceCheckpoint = 0
+	}
+	e.reportProgress()
+
+	if jobCtx.Err() != nil {
+		cause = fatalErr
+		if cause == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			cause = ErrTimeout
+		} else if cause == nil {
+			cause = ErrInterrupted
+		}
+	}
+	return failures, fetched, cause, nil
+}
+
+// getPairs fetches the [start, end) range of pairs. When stateBlock is not 0, the state of every pair
+// at stateBlock is fetched as well. Pairs not fetched because the context is done are left out of both
+// pairs and failures. With FailFast, the first pair failing on a node rather than a pair error is returned
+// as a PairError.
+func (e *Exporter) getPairs(
+	ctx context.Context, start int, end int, stateBlock uint64,
+) ([]dex.Pair, []store.Failure, error) {
+	e.logger.Debug("Getting dex pairs", "start", start, "end", end)
+
+	var pairs []*dex.Pair
+	var errs []error
+	if bd, ok := e.exchange.(dex.BatchDexExchange); ok {
+		pairs, errs = bd.GetPairs(ctx, int64(start), int64(end))
+	} else {
+		for i := start; i < end; i++ {
+			pair, err := e.exchange.GetPair(ctx, int64(i))
+			pairs = append(pairs, pair)
+			errs = append(errs, err)
+		}
+	}
+	if sd, ok := e.exchange.(dex.StateDexExchange); ok && stateBlock != 0 {
+		var fetchedPairs []*dex.Pair
+		var fetchedIndices []int
+		for i := range pairs {
+			if errs[i] == nil {
+				fetchedPairs = append(fetchedPairs, pairs[i])
+				fetchedIndices = append(fetchedIndices, i)
+			}
+		}
+		if len(fetchedPairs) > 0 {
+			for i, err := range sd.GetPairStates(ctx, fetchedPairs, stateBlock) {
+				errs[fetchedIndices[i]] = err
+			}
+		}
+	}
+
+	var res []dex.Pair
+	var failures []store.Failure
+	var fatal error
+	for i := range pairs {
+		if errs[i] != nil && ctx.Err() != nil {
+			continue
+		}
+		if errs[i] != nil {
+			class := dex.ClassifyError(errs[i])
+			e.logger.Warn("Error getting pair", "pairIndex", start+i, "class", class.String(), "error", errs[i])
+			metrics.AddFailure(e.ds.Dex, e.ds.ChainId, class.String())
+			failures = append(failures, store.Failure{
+				Index: int64(start + i),
+				Class: class.String(),
+				Error: errs[i].Error(),
+			})
+			if e.opts.FailFast && class != dex.ErrorClassPermanent && fatal == nil {
+				fatal = &PairError{Index: int64(start + i), Class: class, Err: errs[i]}
+			}
+			continue
+		}
+		e.logger.Debug("Fetched pair", "pairIndex", start+i, "pairAddress", pairs[i].Address)
+		res = append(res, *pairs[i])
+	}
+	e.tracker.add(len(res), len(failures))
+	metrics.AddPairs(e.ds.Dex, e.ds.ChainId, len(res))
+	return res, failures, fatal
+}
+
+// getExportBlock returns the block every call of the export is made at. Unless the block is given,
+// an unfinished export keeps the block of the store's cursor, so the pairs it already fetched and the
+// ones it fetches now come from the same chain state. Any other export, including the next run of a
+// complete one, is pinned to the latest block minus confirmations so it picks up pairs created since.
+func getExportBlock(
+	ctx context.Context, provider contracts.Provider, block uint64, confirmations uint64,
+	fetched map[int64]dex.Pair, cursor *store.Cursor,
+) (uint64, error) {
+	if block != 0 {
+		return block, nil
+	}
+	if len(fetched) > 0 && cursor != nil && !cursor.Complete {
+		return cursor.Block, nil
+	}
+	head, err := dex.GetBlockNumber(ctx, provider)
+	if err != nil {
+		return 0, err
+	}
+	if head < confirmations {
+		return 0, fmt.Errorf("latest block %d has less than %d confirmations", head, confirmations)
+	}
+	return head - confirmations, nil
+}
+
+// dropStaleStates removes pairs without a state at the block from fetched, so they are fetched again
+func dropStaleStates(fetched map[int64]dex.Pair, block uint64) []int64 {
+	var dropped []int64
+	for index, pair := range fetched {
+		if pair.State == nil || pair.State.Block != block {
+			delete(fetched, index)
+			dropped = append(dropped, index)
+		}
+	}
+	return dropped
+}
+
+// dropPendingPairs removes watched pairs without enough confirmations from fetched, as a reorg may have
+// dropped them since they were saved. Pairs which still exist are fetched or watched again.
+func dropPendingPairs(fetched map[int64]dex.Pair) []int64 {
+	var dropped []int64
+	for index, pair := range fetched {
+		if pair.Pending {
+			delete(fetched, index)
+			dropped = append(dropped, index)
+		}
+	}
+	return dropped
+}
+
+// getMissingJobs splits factory indices in [0, pairCount) that are not yet fetched into jobs of at most step pairs.
+// Every job covers a contiguous range of indices.
+func getMissingJobs(fetched map[int64]dex.Pair, pairCount int, step int) []job {
+	var jobs []job
+	for i := 0; i < pairCount; i++ {
+		if _, ok := fetched[int64(i)]; ok {
+			continue
+		}
+		last := len(jobs) - 1
+		if last >= 0 && jobs[last].end == i && jobs[last].end-jobs[last].start < step {
+			jobs[last].end++
+			continue
+		}
+		jobs = append(jobs, job{start: i, end: i + 1})
+	}
+	return jobs
+}
+
+// sortedPairs returns pairs ordered by their factory index
+func sortedPairs(pairs map[int64]dex.Pair) []dex.Pair {
+	res := make([]dex.Pair, 0, len(pairs))
+	for _, pair := range pairs {
+		res = append(res, pair)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Index < res[j].Index
+	})
+	return res
+}
+
+// sortedFailures returns failures ordered by their factory index
+func sortedFailures(failures map[int64]store.Failure) []store.Failure {
+	res := make([]store.Failure, 0, len(failures))
+	for _, f := range failures {
+		res = append(res, f)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Index < res[j].Index
+	})
+	return res
+}
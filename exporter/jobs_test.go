@@ -0,0 +1,121 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/dex"
+	"github.com/nikolalosic/dex-pairs/store"
+	"reflect"
+	"testing"
+)
+
+// headProvider serves eth_blockNumber at the head block and counts the calls
+type headProvider struct {
+	head  uint64
+	calls int
+}
+
+func (p *headProvider) Call(ctx context.Context, method string, out interface{}, params ...interface{}) error {
+	if method != "eth_blockNumber" {
+		return fmt.Errorf("unexpected method %s", method)
+	}
+	p.calls++
+	*out.(*string) = fmt.Sprintf("0x%x", p.head)
+	return nil
+}
+
+func TestGetExportBlock(t *testing.T) {
+	pairs := map[int64]dex.Pair{0: {Index: 0}, 1: {Index: 1}}
+	tests := []struct {
+		name    string
+		block   uint64
+		fetched map[int64]dex.Pair
+		cursor  *store.Cursor
+		want    uint64
+		// head is set when the latest block is read
+		head bool
+	}{
+		{name: "fresh store", want: 990, head: true},
+		{name: "given block", block: 500, fetched: pairs, cursor: &store.Cursor{Block: 800}, want: 500},
+		{name: "unfinished export", fetched: pairs, cursor: &store.Cursor{Block: 800}, want: 800},
+		{name: "complete export", fetched: pairs, cursor: &store.Cursor{Block: 800, Complete: true}, want: 990, head: true},
+		{name: "cursor without pairs", cursor: &store.Cursor{Block: 800}, want: 990, head: true},
+		{name: "pairs without cursor", fetched: pairs, want: 990, head: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &headProvider{head: 1000}
+			block, err := getExportBlock(context.Background(), provider, tt.block, 10, tt.fetched, tt.cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if block != tt.want {
+				t.Errorf("expected block %d, got %d", tt.want, block)
+			}
+			if read := provider.calls > 0; read != tt.head {
+				t.Errorf("expected latest block read %v, got %v", tt.head, read)
+			}
+		})
+	}
+}
+
+func TestGetExportBlockTooFewConfirmations(t *testing.T) {
+	if _, err := getExportBlock(context.Background(), &headProvider{head: 5}, 0, 10, nil, nil); err == nil {
+		t.Error("expected error when the chain is shorter than the confirmations")
+	}
+}
+
+// fetchedPairs returns fetched pairs of the indices
+func fetchedPairs(indices ...int64) map[int64]dex.Pair {
+	fetched := map[int64]dex.Pair{}
+	for _, index := range indices {
+		fetched[index] = dex.Pair{Index: index}
+	}
+	return fetched
+}
+
+func TestGetMissingJobs(t *testing.T) {
+	tests := []struct {
+		name      string
+		fetched   map[int64]dex.Pair
+		pairCount int
+		step      int
+		want      []job
+	}{
+		{name: "fresh store", fetched: fetchedPairs(), pairCount: 5, step: 10, want: []job{{0, 5}}},
+		{name: "all fetched", fetched: fetchedPairs(0, 1, 2), pairCount: 3, step: 10},
+		{name: "no pairs", fetched: fetchedPairs(), pairCount: 0, step: 10},
+		{name: "new pairs", fetched: fetchedPairs(0, 1, 2), pairCount: 5, step: 10, want: []job{{3, 5}}},
+		{
+			name: "gaps", fetched: fetchedPairs(0, 3, 4, 7), pairCount: 9, step: 10,
+			want: []job{{1, 3}, {5, 7}, {8, 9}},
+		},
+		// failed pairs are not in the store, so a resumed export fetches their indices again
+		{name: "previously failed", fetched: fetchedPairs(0, 1, 3, 4), pairCount: 5, step: 10, want: []job{{2, 3}}},
+		{name: "exactly one step", fetched: fetchedPairs(), pairCount: 4, step: 4, want: []job{{0, 4}}},
+		{name: "step boundary", fetched: fetchedPairs(), pairCount: 9, step: 4, want: []job{{0, 4}, {4, 8}, {8, 9}}},
+		{
+			name: "gap across step boundary", fetched: fetchedPairs(0, 1), pairCount: 8, step: 4,
+			want: []job{{2, 6}, {6, 8}},
+		},
+		{name: "step of one", fetched: fetchedPairs(1), pairCount: 3, step: 1, want: []job{{0, 1}, {2, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if jobs := getMissingJobs(tt.fetched, tt.pairCount, tt.step); !reflect.DeepEqual(jobs, tt.want) {
+				t.Errorf("expected jobs %v, got %v", tt.want, jobs)
+			}
+		})
+	}
+}
+
+func TestGetMissingJobsRefetchesPendingPairs(t *testing.T) {
+	fetched := fetchedPairs(0, 2)
+	fetched[1] = dex.Pair{Index: 1, Pending: true}
+	if dropped := dropPendingPairs(fetched); !reflect.DeepEqual(dropped, []int64{1}) {
+		t.Fatalf("expected pending pair 1 dropped, got %v", dropped)
+	}
+	if jobs := getMissingJobs(fetched, 4, 10); !reflect.DeepEqual(jobs, []job{{1, 2}, {3, 4}}) {
+		t.Errorf("unexpected jobs %v", jobs)
+	}
+}
@@ -0,0 +1,202 @@
+package exporter
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
+	"github.com/umbracle/go-web3"
+	"github.com/umbracle/go-web3/abi"
+	"github.com/umbracle/go-web3/contract/builtin/erc20"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testFactory is the built-in Uniswap V2 factory
+var testFactory = web3.HexToAddress("0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f")
+
+// testOutput returns the output of a contract method for the ABI encoded arguments
+type testOutput func(args []byte) (interface{}, error)
+
+// testContract serves eth_call of the methods of its ABI
+type testContract struct {
+	abi     *abi.ABI
+	outputs map[string]testOutput
+}
+
+// testChain is a chain of Uniswap V2 pairs served by testNode. Blocks are identified by their number.
+type testChain struct {
+	m         sync.Mutex
+	head      uint64
+	contracts map[web3.Address]*testContract
+	pairs     []web3.Address
+	// fail, if set, fails calls of the pair at the index with the error
+	fail map[int64]error
+}
+
+func newTestChain(head uint64) *testChain {
+	c := &testChain{head: head, contracts: map[web3.Address]*testContract{}, fail: map[int64]error{}}
+	c.contracts[testFactory] = &testContract{abi: contracts.UniswapFactoryAbi(), outputs: map[string]testOutput{
+		"allPairsLength": func(args []byte) (interface{}, error) {
+			return big.NewInt(int64(len(c.pairs))), nil
+		},
+		"allPairs": func(args []byte) (interface{}, error) {
+			n := new(big.Int).SetBytes(args).Int64()
+			if n >= int64(len(c.pairs)) {
+				return nil, errReverted
+			}
+			if err := c.fail[n]; err != nil {
+				return nil, err
+			}
+			return c.pairs[n], nil
+		},
+	}}
+	return c
+}
+
+var errReverted = &rpcError{Code: 3, Message: "execution reverted"}
+
+// addToken adds an ERC20 token
+func (c *testChain) addToken(address web3.Address, symbol string, name string, decimals uint8) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.contracts[address] = &testContract{abi: erc20.ERC20Abi(), outputs: map[string]testOutput{
+		"symbol":      func([]byte) (interface{}, error) { return symbol, nil },
+		"name":        func([]byte) (interface{}, error) { return name, nil },
+		"decimals":    func([]byte) (interface{}, error) { return decimals, nil },
+		"totalSupply": func([]byte) (interface{}, error) { return big.NewInt(1000000), nil },
+	}}
+}
+
+// addPair adds a pair of the tokens to the factory and returns its address
+func (c *testChain) addPair(token0 web3.Address, token1 web3.Address) web3.Address {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var address web3.Address
+	address[0] = 0xb0
+	big.NewInt(int64(len(c.pairs))).FillBytes(address[12:])
+	c.pairs = append(c.pairs, address)
+	c.contracts[address] = &testContract{abi: contracts.UniswapPairAbi(), outputs: map[string]testOutput{
+		"symbol":   func([]byte) (interface{}, error) { return "UNI-V2", nil },
+		"name":     func([]byte) (interface{}, error) { return "Uniswap V2", nil },
+		"decimals": func([]byte) (interface{}, error) { return uint8(18), nil },
+		"token0":   func([]byte) (interface{}, error) { return token0, nil },
+		"token1":   func([]byte) (interface{}, error) { return token1, nil },
+	}}
+	return address
+}
+
+func (c *testChain) setHead(head uint64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.head = head
+}
+
+func blockHash(n uint64) web3.Hash {
+	var hash web3.Hash
+	big.NewInt(int64(n) + 1).FillBytes(hash[:])
+	return hash
+}
+
+// rpcError is a JSON-RPC error returned by testNode
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+type testRequest struct {
+	ID     uint64            `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// newTestNode serves the chain over HTTP JSON-RPC, one request at a time
+func newTestNode(t *testing.T, c *testChain) *httptest.Server {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req testRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if result, err := c.serve(req); err != nil {
+			res["error"] = err
+		} else {
+			res["result"] = result
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(node.Close)
+	return node
+}
+
+func (c *testChain) serve(req testRequest) (interface{}, *rpcError) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	switch req.Method {
+	case "eth_blockNumber":
+		return fmt.Sprintf("0x%x", c.head), nil
+	case "eth_getBlockByNumber":
+		var number string
+		if err := json.Unmarshal(req.Params[0], &number); err != nil {
+			return nil, &rpcError{Code: -32602, Message: err.Error()}
+		}
+		var n uint64
+		if _, err := fmt.Sscanf(number, "0x%x", &n); err != nil || n > c.head {
+			return nil, nil
+		}
+		return map[string]interface{}{
+			"number":     number,
+			"hash":       blockHash(n).String(),
+			"parentHash": blockHash(n - 1).String(),
+		}, nil
+	case "eth_call":
+		var msg struct {
+			To   web3.Address `json:"to"`
+			Data string       `json:"data"`
+		}
+		if err := json.Unmarshal(req.Params[0], &msg); err != nil {
+			return nil, &rpcError{Code: -32602, Message: err.Error()}
+		}
+		data, err := hex.DecodeString(strings.TrimPrefix(msg.Data, "0x"))
+		contract, ok := c.contracts[msg.To]
+		if err != nil || len(data) < 4 || !ok {
+			return nil, errReverted
+		}
+		for name, method := range contract.abi.Methods {
+			output, ok := contract.outputs[name]
+			if !ok || hex.EncodeToString(method.ID()) != hex.EncodeToString(data[:4]) {
+				continue
+			}
+			value, err := output(data[4:])
+			if err != nil {
+				if rpcErr, ok := err.(*rpcError); ok {
+					return nil, rpcErr
+				}
+				return nil, &rpcError{Code: -32000, Message: err.Error()}
+			}
+			out, err := abi.Encode([]interface{}{value}, method.Outputs)
+			if err != nil {
+				return nil, &rpcError{Code: -32603, Message: err.Error()}
+			}
+			return "0x" + hex.EncodeToString(out), nil
+		}
+		return nil, errReverted
+	}
+	return nil, &rpcError{Code: -32601, Message: "method not found"}
+}
@@ -0,0 +1,58 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+)
+
+// Progress of the pairs fetched by a running export
+type Progress struct {
+	// Total is the number of pairs to fetch, pairs already in the store excluded
+	Total  int
+	Done   int
+	Failed int
+	// Rate is the number of pairs done or failed per second since the export started
+	Rate    float64
+	Elapsed time.Duration
+	// ETA is the estimated time left, 0 until the first pair is done or failed
+	ETA time.Duration
+}
+
+// tracker counts pairs done and failed by the workers of an export
+type tracker struct {
+	m      sync.Mutex
+	start  time.Time
+	total  int
+	done   int
+	failed int
+}
+
+func newTracker(total int) *tracker {
+	return &tracker{start: time.Now(), total: total}
+}
+
+func (t *tracker) add(done int, failed int) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.done += done
+	t.failed += failed
+}
+
+func (t *tracker) progress() Progress {
+	t.m.Lock()
+	defer t.m.Unlock()
+	p := Progress{Total: t.total, Done: t.done, Failed: t.failed, Elapsed: time.Since(t.start)}
+	processed := t.done + t.failed
+	if processed > 0 && p.Elapsed > 0 {
+		p.Rate = float64(processed) / p.Elapsed.Seconds()
+		p.ETA = time.Duration(float64(t.total-processed) / p.Rate * float64(time.Second))
+	}
+	return p
+}
+
+// reportProgress calls the progress callback with the progress of the running export
+func (e *Exporter) reportProgress() {
+	if e.opts.Progress != nil && e.tracker != nil {
+		e.opts.Progress(e.tracker.progress())
+	}
+}
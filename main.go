@@ -1,227 +1,483 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
+	"github.com/nikolalosic/dex-pairs/contracts"
 	"github.com/nikolalosic/dex-pairs/dex"
+	"github.com/nikolalosic/dex-pairs/exporter"
+	"github.com/nikolalosic/dex-pairs/metrics"
+	"github.com/nikolalosic/dex-pairs/store"
 	"github.com/umbracle/go-web3"
+	"golang.org/x/exp/slog"
+	"io"
 	"io/ioutil"
-	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
 	"runtime"
-	"sync"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
-var uniswapV1FactoryAddress = web3.HexToAddress("0xc0a47dfe034b400b47bdad5fecda2621de6c4d95")
-var uniswapV2FactoryAddress = web3.HexToAddress("0x5c69bee701ef814a2b6a3edd4b1652cb9cc5aa6f")
-var uniswapV3FactoryAddress = web3.HexToAddress("0x1f98431c8ad98523631ae4a59f267346ea31f984")
-var pancakeSwapV1FactoryAddress = web3.HexToAddress("0xbcfccbde45ce874adcb698cc183debcf17952812")
-var pancakeSwapV2FactoryAddress = web3.HexToAddress("0xca143ce32fe78f1f7019d7d551a6402fc5350c73")
-
-var factoryContracts = map[string]map[int]map[int]web3.Address{
-	"pancakeswap": {
-		56: {
-			1: pancakeSwapV1FactoryAddress,
-			2: pancakeSwapV2FactoryAddress,
-		},
-	},
-	"uniswap": {
-		1: {
-			1: uniswapV1FactoryAddress,
-			2: uniswapV2FactoryAddress,
-			3: uniswapV3FactoryAddress,
-		},
-	},
-}
-
-type job struct {
-	start       int
-	end         int
-	dexExchange string
-}
-type result struct {
-	pairs []dex.Pair
-	err   error
-}
-
-type fileTemplate struct {
-	Name      string     `json:"name"`
-	Timestamp time.Time  `json:"timestamp"`
-	Version   version    `json:"version"`
-	Keywords  []string   `json:"keywords"`
-	Tokens    []dex.Pair `json:"tokens"`
-}
-
 type version struct {
 	Major int `json:"major"`
 	Minor int `json:"minor"`
 	Patch int `json:"patch"`
 }
 
-var counter = 0
-var m = sync.RWMutex{}
-
-func getDataFromFile(fileName string) (*fileTemplate, error) {
-	log.Printf("Reading data from file %s", fileName)
-	ft := fileTemplate{}
-	if _, err := os.Stat(fileName); os.IsNotExist(err) {
-		return &ft, nil
-	}
-	content, err := ioutil.ReadFile(fileName)
+func saveFailuresToFile(failures []store.Failure, fileName string) error {
+	slog.Info("Saving failures to file", "failures", len(failures), "file", fileName)
+	data, err := json.MarshalIndent(failures, "", "  ")
 	if err != nil {
-		log.Printf("Error opening file %s", fileName)
-		return nil, err
+		slog.Error("Error marshalling failures", "error", err)
+		return err
 	}
-	err = json.Unmarshal(content, &ft)
+	err = ioutil.WriteFile(fileName, data, 0644)
 	if err != nil {
-		log.Printf("Error unmarshaling json %s", fileName)
-		return nil, err
+		slog.Error("Error writing to file", "file", fileName, "error", err)
+		return err
 	}
-	return &ft, nil
+	return nil
 }
 
-func getPairs(start int, end int, dexExchange string, dexVersion int, chainId int) []dex.Pair {
-	log.Printf("Getting dex pairs. start=%d, end=%d", start, end)
-	d, err := getDex(dexExchange, dexVersion, chainId)
-	if err != nil {
-		panic("Cannot Get DEX")
-	}
-
-	var res []dex.Pair
-	for i := start; i < end; i++ {
-		pair, err := d.GetPair(int64(i))
-		m.Lock()
-		counter++
-		m.Unlock()
+// getEndpoints returns nodes configured for the chain in the endpoints file, or the comma separated
+// list of nodes in the NODE_URL environment variable. Endpoints without their own rate limit get rps.
+func getEndpoints(endpointsFile string, chainId int, rps float64) ([]dex.Endpoint, error) {
+	var endpoints []dex.Endpoint
+	if endpointsFile != "" {
+		content, err := ioutil.ReadFile(endpointsFile)
 		if err != nil {
-			log.Printf("Error getting pair n=%d. Error=%s", i, err.Error())
-			continue
+			slog.Error("Error opening file", "file", endpointsFile, "error", err)
+			return nil, err
+		}
+		chains := map[string][]dex.Endpoint{}
+		err = json.Unmarshal(content, &chains)
+		if err != nil {
+			slog.Error("Error unmarshaling json", "file", endpointsFile, "error", err)
+			return nil, err
+		}
+		endpoints = chains[strconv.Itoa(chainId)]
+	}
+	if len(endpoints) == 0 {
+		for _, url := range strings.Split(os.Getenv("NODE_URL"), ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				endpoints = append(endpoints, dex.Endpoint{URL: url})
+			}
 		}
-		m.RLock()
-		log.Printf("Fetched pair %d, total fetched=%d", i, counter)
-		m.RUnlock()
-		res = append(res, *pair)
 	}
-	return res
+	for i := range endpoints {
+		if endpoints[i].RPS == 0 {
+			endpoints[i].RPS = rps
+		}
+	}
+	return endpoints, nil
 }
 
-func saveToFile(fileData *fileTemplate, fileName string) error {
-	log.Printf("Saving data to file %s", fileName)
-	data, err := json.Marshal(fileData)
-	if err != nil {
-		log.Printf("Error marshalling file template")
-		return err
+// getSanitizePolicy returns the named policy with the settings of explicitly set sanitize flags applied
+func getSanitizePolicy(
+	name string, charset string, maxLength int, replacement string, normalization string,
+) (dex.SanitizePolicy, error) {
+	policy, ok := dex.SanitizePolicies[name]
+	if !ok {
+		return policy, fmt.Errorf("unknown sanitize policy %s", name)
 	}
-	err = ioutil.WriteFile(fileName, data, 0755)
-	if err != nil {
-		log.Printf("Error writing to file %s", fileName)
-		return err
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "sanitize-charset":
+			policy.Charset = nil
+			if charset != "" {
+				policy.Charset, err = regexp.Compile(charset)
+			}
+		case "sanitize-max-length":
+			policy.MaxSymbolLength = maxLength
+		case "sanitize-replacement":
+			policy.Replacement = replacement
+		case "sanitize-normalization":
+			policy.Normalization, err = dex.ParseNormalization(normalization)
+		}
+	})
+	return policy, err
+}
+
+// newLogger creates a logger writing records of the level and above to w in the format, either text or json
+func newLogger(level string, format string, w io.Writer) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %s", level)
 	}
-	return nil
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %s", format)
 }
 
-func getDex(dexId string, dexVersion int, chainId int) (dex.DexExchange, error) {
-	if dexId == "uniswap" {
-		return dex.NewUniswap(factoryContracts[dexId][chainId][dexVersion], chainId, os.Getenv("NODE_URL"))
-	} else if dexId == "pancakeswap" {
-		return dex.NewPancakeSwap(factoryContracts[dexId][chainId][dexVersion], chainId, os.Getenv("NODE_URL"))
+// fatal logs the error and exits
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// serveMetrics serves prometheus metrics on /metrics of the address until the process exits. Contract calls
+// and endpoint requests are recorded from then on.
+func serveMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		slog.Error("Error listening", "addr", addr, "error", err)
+		return err
 	}
-	return nil, errors.New("no appropriate DEX found")
+	contracts.CallObserver = metrics.ObserveCall
+	dex.RequestObserver = metrics.ObserveRequest
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	slog.Info("Serving metrics", "url", "http://"+listener.Addr().String()+"/metrics")
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			slog.Error("Error serving metrics", "error", err)
+		}
+	}()
+	return nil
 }
 
 //ExportPairs Exports DEX pairs to a file
 func ExportPairs(
-	inputFile string, outputFile string, dexExchange string, cores int, chainId int, dexVersion int,
+	ctx context.Context, opts exporter.Options, inputFile string, outputFile string, storeURL string,
+	failuresFile string, tokenListFile string, logoURITemplate string, progress *progressPrinter,
 ) error {
-	exchange, err := getDex(dexExchange, dexVersion, chainId)
-	if err != nil {
-		panic("Cannot Get DEX")
+	// without a store URL the input file is read and the output file rewritten, otherwise the output file
+	// is a view written from the store
+	var err error
+	opts.Store = store.NewJSONFile(inputFile, outputFile, opts.Logger)
+	if storeURL != "" {
+		opts.Store, err = store.Open(storeURL, opts.Logger)
+		if err != nil {
+			slog.Error("Error opening store", "error", err)
+			return err
+		}
 	}
-	pn, err := exchange.GetPairNumber()
-	if err != nil {
-		log.Printf("Error getting all pairs length")
-		return err
+	defer opts.Store.Close()
+	if progress != nil {
+		opts.Progress = progress.report
 	}
-	pairCount := int(pn.Int64())
-	data, err := getDataFromFile(inputFile)
+	ex, err := exporter.New(opts)
 	if err != nil {
-		log.Printf("Error reading data from input file")
 		return err
 	}
-	n := len(data.Tokens) - 1
-	if n < 0 {
-		n = 0
+	saveTokens := func() error {
+		if tokenListFile == "" {
+			return nil
+		}
+		list := getTokenList(fmt.Sprintf("%s V%d tokens", opts.Dex, opts.Version), ex.Pairs(), logoURITemplate)
+		return saveTokenList(list, tokenListFile)
 	}
-	step := 300
-	if step > pairCount {
-		step = pairCount
+	// saveView writes the output file from the store given by URL
+	saveView := func() error {
+		if storeURL == "" || outputFile == "" {
+			return nil
+		}
+		view := store.NewJSONFile("", outputFile, opts.Logger)
+		if err := store.Copy(view, opts.Store, ex.Dataset()); err != nil {
+			slog.Error("Error writing output file from store", "error", err)
+			return err
+		}
+		return view.Close()
 	}
-	jobCount := (pairCount - n) / step
-	fmt.Println(fmt.Sprintf("pairCount=%d, n=%d, step=%d", pairCount, n, step))
-	if (pairCount-n)%step != 0 {
-		jobCount++
+
+	res, exportErr := ex.Export(ctx)
+	if progress != nil {
+		progress.finish()
 	}
-	if jobCount == 0 {
-		log.Printf("No jobs to run")
-		return nil
+	if res == nil {
+		return exportErr
 	}
-	if jobCount < cores {
-		cores = jobCount
+	if failuresFile != "" {
+		if err := saveFailuresToFile(res.Failures, failuresFile); err != nil {
+			return err
+		}
 	}
-
-	jobs := make(chan job, cores)
-	results := make(chan result)
-	runtime.GOMAXPROCS(cores)
-
-	for i := 0; i < cores; i++ {
-		go func(js <-chan job, rs chan<- result) {
-			for j := range js {
-				rs <- result{err: nil, pairs: getPairs(j.start, j.end, dexExchange, dexVersion, chainId)}
-			}
-		}(jobs, results)
+	if exportErr != nil {
+		return exportErr
 	}
-	for i := n; i < pairCount; i += step {
-		if i+step > pairCount {
-			jobs <- job{start: i, end: pairCount, dexExchange: dexExchange}
-		} else {
-			jobs <- job{start: i, end: i + step, dexExchange: dexExchange}
-		}
+	if err := saveView(); err != nil {
+		return err
 	}
-
-	close(jobs)
-	for i := 0; i < jobCount; i++ {
-		r := <-results
-		data.Tokens = append(data.Tokens, r.pairs...)
-		if r.err != nil {
-			log.Printf(r.err.Error())
-		}
+	if err := saveTokens(); err != nil {
+		return err
 	}
-
-	log.Printf("Completed getting pairs")
-	err = saveToFile(data, outputFile)
+	if opts.WatchURL == "" {
+		return nil
+	}
+	err = ex.Watch(ctx, func(update *dex.PairUpdate) {
+		if err := saveTokens(); err != nil {
+			slog.Error("Error saving token list", "error", err)
+		}
+	})
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return saveView()
 }
 
 func main() {
 	var inputFile, outputFile, dexExchange string
-	var cores, chainId, dexVersion int
+	var batchMode, multicallAddress string
+	var cores, chainId, dexVersion, batchSize, checkpointJobs int
+	var checkpointInterval time.Duration
+	var failuresFile string
+	var endpointsFile, balanceStrategy string
+	var dexConfigFile string
+	var state bool
+	var block, confirmations uint64
+	var tokenListFile, logoURITemplate string
+	var sanitize, sanitizeCharset, sanitizeReplacement, sanitizeNormalization string
+	var sanitizeMaxLength int
+	var watchURL string
+	var watchConfirmations uint64
+	var storeURL string
+	var timeout time.Duration
+	var failFast bool
+	var progressMode string
+	var progressInterval time.Duration
+	var metricsAddr string
+	var logLevel, logFormat string
+	var rps float64
+	providerConfig := dex.ProviderConfig{Retry: dex.DefaultRetryPolicy()}
 	flag.StringVar(&inputFile, "input-file", "dex-pairs.json", "Specify input file.")
 	flag.StringVar(&outputFile, "output-file", "dex-pairs.json", "Specify output file.")
 	flag.IntVar(&cores, "cores", runtime.NumCPU()/2, "Specify number of cores to use. Default is runtime.NumCPU()/2.")
 	flag.StringVar(&dexExchange, "dex-exchange", "uniswap", "Specify from which DEX exchange to get pairs.")
 	flag.IntVar(&chainId, "chain-id", 1, "Specify chain id.")
 	flag.IntVar(&dexVersion, "dex-version", 2, "Specify from which DEX exchange version to get pairs.")
+	flag.StringVar(
+		&batchMode, "batch-mode", "multicall",
+		"Specify how calls are batched, either through Multicall3 (multicall) or JSON-RPC batches (jsonrpc).",
+	)
+	flag.IntVar(
+		&batchSize, "batch-size", dex.DefaultBatchSize,
+		"Specify number of calls batched into a single request. Use 0 to disable batching.",
+	)
+	flag.StringVar(
+		&multicallAddress, "multicall-address", dex.DefaultMulticallAddress.String(),
+		"Specify address of the Multicall3 contract.",
+	)
+	flag.IntVar(
+		&checkpointJobs, "checkpoint-jobs", 10,
+		"Specify after how many completed jobs the output file is rewritten. Use 0 to disable.",
+	)
+	flag.DurationVar(
+		&checkpointInterval, "checkpoint-interval", time.Minute,
+		"Specify how often the output file is rewritten while pairs are being fetched.",
+	)
+	flag.IntVar(
+		&providerConfig.Retry.MaxAttempts, "max-attempts", providerConfig.Retry.MaxAttempts,
+		"Specify how many times a failing RPC call is attempted before giving up.",
+	)
+	flag.DurationVar(
+		&providerConfig.Retry.BaseDelay, "retry-base-delay", providerConfig.Retry.BaseDelay,
+		"Specify the initial backoff delay between RPC call attempts.",
+	)
+	flag.DurationVar(
+		&providerConfig.Retry.MaxDelay, "retry-max-delay", providerConfig.Retry.MaxDelay,
+		"Specify the maximum backoff delay between RPC call attempts.",
+	)
+	flag.StringVar(
+		&failuresFile, "failures-file", "dex-pairs-failures.json",
+		"Specify file listing pairs that could not be fetched. Use empty string to disable.",
+	)
+	flag.Float64Var(
+		&rps, "rps", 0,
+		"Specify maximum number of RPC requests per second shared by all workers, for every endpoint without "+
+			"its own limit. Use 0 for no limit.",
+	)
+	flag.BoolVar(
+		&providerConfig.AdaptiveRate, "adaptive-rps", false,
+		"Lower the request rate when the node throttles requests and raise it back to -rps when it stops. "+
+			"Requires a rate limit of every endpoint.",
+	)
+	flag.StringVar(
+		&endpointsFile, "endpoints-file", "",
+		"Specify JSON file with node endpoints per chain id. Defaults to comma separated NODE_URL list.",
+	)
+	flag.StringVar(
+		&balanceStrategy, "balance", string(dex.RoundRobin),
+		"Specify how calls are spread across endpoints, either round-robin or latency.",
+	)
+	flag.DurationVar(
+		&providerConfig.Cooldown, "endpoint-cooldown", dex.DefaultCooldown,
+		"Specify for how long a failing endpoint is taken out of rotation.",
+	)
+	flag.StringVar(
+		&dexConfigFile, "dex-config", "",
+		"Specify YAML or JSON file with DEX deployments added to the built-in ones.",
+	)
+	flag.BoolVar(
+		&state, "state", false,
+		"Add reserves, total supply, kLast and cumulative prices of every pair at a single block to the output.",
+	)
+	flag.Uint64Var(
+		&block, "block", 0,
+		"Specify block number of every call. "+
+			"Use 0 for the block of an unfinished export or latest block minus -confirmations.",
+	)
+	flag.Uint64Var(
+		&confirmations, "confirmations", 0,
+		"Specify number of confirmations of the block the export is pinned to when -block is 0.",
+	)
+	flag.StringVar(
+		&tokenListFile, "token-list-file", "",
+		"Specify file the tokenlists.org token list of all pair tokens is written to. Use empty string to disable.",
+	)
+	flag.StringVar(
+		&logoURITemplate, "token-list-logo-uri", "",
+		"Specify logo URI of tokens in the token list, with {chainId} and {address} replaced by the token's.",
+	)
+	flag.StringVar(
+		&sanitize, "sanitize", "strict",
+		"Specify how token symbols and names are sanitized, either strict, ui (strips emoji) or raw.",
+	)
+	flag.StringVar(
+		&sanitizeCharset, "sanitize-charset", "",
+		"Specify regular expression matching a single allowed character of token symbols and names. "+
+			"Use empty string to allow all characters.",
+	)
+	flag.IntVar(
+		&sanitizeMaxLength, "sanitize-max-length", 0,
+		"Specify maximum number of characters of token symbols. Use 0 for no limit.",
+	)
+	flag.StringVar(
+		&sanitizeReplacement, "sanitize-replacement", "",
+		"Specify the value of token symbols and names which are empty or not allowed.",
+	)
+	flag.StringVar(
+		&sanitizeNormalization, "sanitize-normalization", "",
+		"Specify unicode normalization of token symbols and names, either none, nfc or nfkc.",
+	)
+	flag.StringVar(
+		&watchURL, "watch-url", "",
+		"Specify websocket node URL to follow pairs created after the export. Use empty string to exit after the export.",
+	)
+	flag.Uint64Var(
+		&watchConfirmations, "watch-confirmations", 12,
+		"Specify number of confirmations after which a watched pair is final and no longer rolled back on a reorg.",
+	)
+	flag.StringVar(
+		&storeURL, "store", "",
+		"Specify URL of the store pairs are kept in instead of -input-file, either json://, ndjson://, sqlite:// "+
+			"or postgres://. The output file is written from it. Use empty string to read and rewrite the files.",
+	)
+	flag.DurationVar(
+		&providerConfig.CallTimeout, "call-timeout", 30*time.Second,
+		"Specify how long a single RPC call may take before it fails and is retried. Use 0 for no limit.",
+	)
+	flag.DurationVar(
+		&timeout, "timeout", 0,
+		"Specify maximum duration of the export, after which it is stopped and fetched pairs are saved. "+
+			"Use 0 for no limit.",
+	)
+	flag.BoolVar(
+		&failFast, "fail-fast", false,
+		"Stop the export on the first pair failing on the node, i.e. with a retryable or rate limit error left "+
+			"after all attempts, instead of recording it as a failure.",
+	)
+	flag.StringVar(
+		&progressMode, "progress", "auto",
+		"Specify how progress is reported, either tty (a status line), json (JSON events), none or auto, "+
+			"which is tty when stderr is a terminal and json otherwise.",
+	)
+	flag.DurationVar(
+		&progressInterval, "progress-interval", 10*time.Second,
+		"Specify how often JSON progress events are written.",
+	)
+	flag.StringVar(
+		&metricsAddr, "metrics-addr", "",
+		"Specify address prometheus metrics are served on at /metrics, e.g. :9090. Use empty string to disable.",
+	)
+	flag.StringVar(
+		&logLevel, "log-level", "info",
+		"Specify the minimum level of logged records, either debug, info, warn or error. Pairs are logged at debug.",
+	)
+	flag.StringVar(&logFormat, "log-format", "text", "Specify format of log records, either text or json.")
 	flag.Parse()
-	err := ExportPairs(inputFile, outputFile, dexExchange, cores, chainId, dexVersion)
+	progress, err := newProgressPrinter(progressMode, progressInterval)
+	if err != nil {
+		fatal("Error creating progress printer", "error", err)
+	}
+	var logOutput io.Writer = os.Stderr
+	if progress != nil && progress.tty {
+		logOutput = progress
+	}
+	logger, err := newLogger(logLevel, logFormat, logOutput)
+	if err != nil {
+		fatal("Error creating logger", "error", err)
+	}
+	slog.SetDefault(logger)
+	policy, err := getSanitizePolicy(
+		sanitize, sanitizeCharset, sanitizeMaxLength, sanitizeReplacement, sanitizeNormalization,
+	)
+	if err != nil {
+		fatal("Error reading sanitize policy", "error", err)
+	}
+	registry := dex.NewRegistry()
+	if dexConfigFile != "" {
+		if err := registry.LoadFile(dexConfigFile); err != nil {
+			fatal("Error loading DEX config", "error", err)
+		}
+	}
+	providerConfig.Strategy = dex.BalanceStrategy(balanceStrategy)
+	endpoints, err := getEndpoints(endpointsFile, chainId, rps)
+	if err != nil {
+		fatal("Error reading endpoints", "error", err)
+	}
+	providerConfig.Endpoints = endpoints
+	if metricsAddr != "" {
+		if err := serveMetrics(metricsAddr); err != nil {
+			fatal("Error serving metrics", "error", err)
+		}
+	}
+	// a signal or the timeout cancels the export, which saves the pairs fetched so far
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	runtime.GOMAXPROCS(cores)
+	opts := exporter.Options{
+		Dex:                dexExchange,
+		Version:            dexVersion,
+		ChainId:            chainId,
+		Registry:           registry,
+		Provider:           providerConfig,
+		Concurrency:        cores,
+		BatchMode:          batchMode,
+		BatchSize:          batchSize,
+		MulticallAddress:   web3.HexToAddress(multicallAddress),
+		CheckpointJobs:     checkpointJobs,
+		CheckpointInterval: checkpointInterval,
+		State:              state,
+		Block:              block,
+		Confirmations:      confirmations,
+		SanitizePolicy:     &policy,
+		FailFast:           failFast,
+		WatchURL:           watchURL,
+		WatchConfirmations: watchConfirmations,
+	}
+	err = ExportPairs(
+		ctx, opts, inputFile, outputFile, storeURL, failuresFile, tokenListFile, logoURITemplate, progress,
+	)
 	if err != nil {
-		log.Fatalf("Error exporing pairs")
-		return
+		fatal("Error exporting pairs", "error", err)
 	}
 }
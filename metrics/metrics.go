@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metrics are registered with the default prometheus registry, so services embedding the exporter
+// expose them on their own metrics endpoint.
+var (
+	calls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexpairs_rpc_calls_total",
+		Help: "Contract calls by method, batched calls included.",
+	}, []string{"method"})
+	callDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dexpairs_rpc_call_duration_seconds",
+		Help:    "Duration of contract calls by method, retries included. Batched calls take as long as their batch.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexpairs_endpoint_requests_total",
+		Help: "JSON-RPC requests sent to endpoints by endpoint host and JSON-RPC method.",
+	}, []string{"endpoint", "method"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dexpairs_endpoint_request_duration_seconds",
+		Help:    "Duration of JSON-RPC requests by endpoint host.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint"})
+	requestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexpairs_endpoint_errors_total",
+		Help: "Failed JSON-RPC requests by endpoint host and error class.",
+	}, []string{"endpoint", "class"})
+	pairsFetched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexpairs_pairs_fetched_total",
+		Help: "Pairs fetched or watched by DEX and chain id.",
+	}, []string{"dex", "chain_id"})
+	pairFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dexpairs_pair_failures_total",
+		Help: "Pairs that could not be fetched by DEX, chain id and error class.",
+	}, []string{"dex", "chain_id", "class"})
+	lastPairIndex = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dexpairs_last_pair_index",
+		Help: "Highest factory index of the pairs saved to the store by DEX and chain id.",
+	}, []string{"dex", "chain_id"})
+	syncedBlock = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dexpairs_synced_block",
+		Help: "Block the pairs saved to the store are synced to by DEX and chain id.",
+	}, []string{"dex", "chain_id"})
+	queuedJobs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dexpairs_job_queue_length",
+		Help: "Jobs of the running export not yet taken by a worker by DEX and chain id.",
+	}, []string{"dex", "chain_id"})
+	busyWorkers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dexpairs_busy_workers",
+		Help: "Workers of the running export fetching a job by DEX and chain id.",
+	}, []string{"dex", "chain_id"})
+)
+
+// Handler serves the metrics of the default prometheus registry
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveCall records a contract call of the method
+func ObserveCall(method string, duration time.Duration) {
+	calls.WithLabelValues(method).Inc()
+	callDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// ObserveRequest records a JSON-RPC request sent to the endpoint host. class is the error class of a failed
+// request and empty otherwise.
+func ObserveRequest(host string, method string, duration time.Duration, class string) {
+	requests.WithLabelValues(host, method).Inc()
+	requestDuration.WithLabelValues(host).Observe(duration.Seconds())
+	if class != "" {
+		requestErrors.WithLabelValues(host, class).Inc()
+	}
+}
+
+// AddPairs records pairs fetched or watched
+func AddPairs(dex string, chainId int, count int) {
+	pairsFetched.WithLabelValues(dex, strconv.Itoa(chainId)).Add(float64(count))
+}
+
+// AddFailure records a pair that could not be fetched
+func AddFailure(dex string, chainId int, class string) {
+	pairFailures.WithLabelValues(dex, strconv.Itoa(chainId), class).Inc()
+}
+
+// SetSynced records the highest pair index and the block saved to the store
+func SetSynced(dex string, chainId int, lastIndex int64, block uint64) {
+	lastPairIndex.WithLabelValues(dex, strconv.Itoa(chainId)).Set(float64(lastIndex))
+	syncedBlock.WithLabelValues(dex, strconv.Itoa(chainId)).Set(float64(block))
+}
+
+// AddQueuedJobs changes the number of queued jobs by delta
+func AddQueuedJobs(dex string, chainId int, delta int) {
+	queuedJobs.WithLabelValues(dex, strconv.Itoa(chainId)).Add(float64(delta))
+}
+
+// AddBusyWorkers changes the number of busy workers by delta
+func AddBusyWorkers(dex string, chainId int, delta int) {
+	busyWorkers.WithLabelValues(dex, strconv.Itoa(chainId)).Add(float64(delta))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/exporter"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+type progressEvent struct {
+	Event          string    `json:"event"`
+	Time           time.Time `json:"time"`
+	Total          int       `json:"total"`
+	Done           int       `json:"done"`
+	Failed         int       `json:"failed"`
+	PairsPerSecond float64   `json:"pairsPerSecond"`
+	ElapsedSeconds float64   `json:"elapsedSeconds"`
+	ETASeconds     float64   `json:"etaSeconds"`
+}
+
+// progressPrinter writes export progress to stderr, either as a status line redrawn in place on a terminal
+// or as JSON events at most every interval. On a terminal it is also the log output, so log lines are
+// written above the status line.
+type progressPrinter struct {
+	m        sync.Mutex
+	out      *os.File
+	tty      bool
+	interval time.Duration
+	// line is the status line shown on the terminal, pending the last progress not written as JSON event
+	line    string
+	pending *exporter.Progress
+	last    time.Time
+}
+
+// newProgressPrinter creates a printer for the mode, either auto, tty, json or none. auto prints a status line
+// when stderr is a terminal and JSON events otherwise. The printer of mode none is nil.
+func newProgressPrinter(mode string, interval time.Duration) (*progressPrinter, error) {
+	p := &progressPrinter{out: os.Stderr, interval: interval}
+	switch mode {
+	case "auto":
+		info, err := os.Stderr.Stat()
+		p.tty = err == nil && info.Mode()&os.ModeCharDevice != 0
+	case "tty":
+		p.tty = true
+	case "json":
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown progress mode %s", mode)
+	}
+	return p, nil
+}
+
+// Write writes a log line, clearing the status line before and redrawing it after
+func (p *progressPrinter) Write(b []byte) (int, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.line == "" {
+		return p.out.Write(b)
+	}
+	fmt.Fprint(p.out, "\r\033[K")
+	n, err := p.out.Write(b)
+	fmt.Fprint(p.out, p.line)
+	return n, err
+}
+
+func (p *progressPrinter) report(progress exporter.Progress) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.tty {
+		p.line = formatProgress(progress)
+		fmt.Fprint(p.out, "\r\033[K"+p.line)
+		return
+	}
+	p.pending = &progress
+	if time.Since(p.last) >= p.interval {
+		p.writeEvent()
+	}
+}
+
+// finish ends the status line or writes the last progress as JSON event
+func (p *progressPrinter) finish() {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.line != "" {
+		fmt.Fprintln(p.out)
+		p.line = ""
+	}
+	if p.pending != nil {
+		p.writeEvent()
+	}
+}
+
+func (p *progressPrinter) writeEvent() {
+	event := progressEvent{
+		Event:          "progress",
+		Time:           time.Now().UTC(),
+		Total:          p.pending.Total,
+		Done:           p.pending.Done,
+		Failed:         p.pending.Failed,
+		PairsPerSecond: math.Round(p.pending.Rate*100) / 100,
+		ElapsedSeconds: math.Round(p.pending.Elapsed.Seconds()*100) / 100,
+		ETASeconds:     math.Round(p.pending.ETA.Seconds()*100) / 100,
+	}
+	data, _ := json.Marshal(event)
+	fmt.Fprintln(p.out, string(data))
+	p.pending = nil
+	p.last = time.Now()
+}
+
+func formatProgress(p exporter.Progress) string {
+	percent := 100.0
+	if p.Total > 0 {
+		percent = float64(p.Done+p.Failed) * 100 / float64(p.Total)
+	}
+	eta := "-"
+	if p.ETA > 0 || p.Done+p.Failed == p.Total {
+		eta = p.ETA.Round(time.Second).String()
+	}
+	return fmt.Sprintf(
+		"%d/%d pairs (%.1f%%), %d failed, %.1f pairs/s, elapsed %s, ETA %s",
+		p.Done+p.Failed, p.Total, percent, p.Failed, p.Rate, p.Elapsed.Round(time.Second), eta,
+	)
+}
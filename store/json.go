@@ -0,0 +1,189 @@
+package store
+
+import (
+	"encoding/json"
+	"github.com/nikolalosic/dex-pairs/dex"
+	"golang.org/x/exp/slog"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+type fileTemplate struct {
+	Name      string     `json:"name"`
+	Timestamp time.Time  `json:"timestamp"`
+	Version   version    `json:"version"`
+	Keywords  []string   `json:"keywords"`
+	Block     uint64     `json:"block,omitempty"`
+	BlockHash string     `json:"blockHash,omitempty"`
+	Complete  bool       `json:"complete,omitempty"`
+	Tokens    []dex.Pair `json:"tokens"`
+}
+
+type version struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Patch int `json:"patch"`
+}
+
+// jsonFile is a Store of a single dataset in the JSON export format. Pairs are read from the input file
+// and the whole output file is rewritten whenever pairs change. Failures are not stored.
+type jsonFile struct {
+	inputFile  string
+	outputFile string
+	data       *fileTemplate
+	// dirty is set when the output file is behind the data
+	dirty  bool
+	logger *slog.Logger
+}
+
+// NewJSONFile creates a store reading pairs from the input file, if it exists, and writing them to the output file
+func NewJSONFile(inputFile string, outputFile string, logger *slog.Logger) Store {
+	return &jsonFile{inputFile: inputFile, outputFile: outputFile, logger: loggerOrDefault(logger)}
+}
+
+func (j *jsonFile) load() error {
+	if j.data != nil {
+		return nil
+	}
+	j.logger.Info("Reading data from file", "file", j.inputFile)
+	ft := fileTemplate{}
+	// pairs read from another file are written to the output file even if none of them change
+	j.dirty = j.inputFile != j.outputFile
+	if _, err := os.Stat(j.inputFile); os.IsNotExist(err) {
+		j.data = &ft
+		return nil
+	}
+	content, err := ioutil.ReadFile(j.inputFile)
+	if err != nil {
+		j.logger.Error("Error opening file", "file", j.inputFile, "error", err)
+		return err
+	}
+	err = json.Unmarshal(content, &ft)
+	if err != nil {
+		j.logger.Error("Error unmarshaling json", "file", j.inputFile, "error", err)
+		return err
+	}
+	j.data = &ft
+	return nil
+}
+
+func (j *jsonFile) save() error {
+	j.logger.Info("Saving data to file", "file", j.outputFile)
+	if j.data.Tokens == nil {
+		j.data.Tokens = []dex.Pair{}
+	}
+	data, err := json.Marshal(j.data)
+	if err != nil {
+		j.logger.Error("Error marshalling file template", "error", err)
+		return err
+	}
+	// write to a temporary file first, so an interrupted write never corrupts the previous output
+	tmpFileName := j.outputFile + ".tmp"
+	err = ioutil.WriteFile(tmpFileName, data, 0755)
+	if err != nil {
+		j.logger.Error("Error writing to file", "file", tmpFileName, "error", err)
+		return err
+	}
+	err = os.Rename(tmpFileName, j.outputFile)
+	if err != nil {
+		j.logger.Error("Error renaming file", "from", tmpFileName, "to", j.outputFile, "error", err)
+		return err
+	}
+	j.dirty = false
+	return nil
+}
+
+// Load returns the pairs of the file, which holds a single dataset
+func (j *jsonFile) Load(ds Dataset) ([]dex.Pair, error) {
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	pairs := append([]dex.Pair(nil), j.data.Tokens...)
+	sort.SliceStable(pairs, func(a, b int) bool {
+		return pairs[a].Index < pairs[b].Index
+	})
+	return pairs, nil
+}
+
+func (j *jsonFile) UpsertPairs(ds Dataset, pairs []dex.Pair) error {
+	if err := j.load(); err != nil {
+		return err
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	positions := map[string]int{}
+	for i, pair := range j.data.Tokens {
+		positions[pair.Address] = i
+	}
+	for _, pair := range pairs {
+		if i, ok := positions[pair.Address]; ok {
+			j.data.Tokens[i] = pair
+			continue
+		}
+		positions[pair.Address] = len(j.data.Tokens)
+		j.data.Tokens = append(j.data.Tokens, pair)
+	}
+	sort.SliceStable(j.data.Tokens, func(a, b int) bool {
+		return j.data.Tokens[a].Index < j.data.Tokens[b].Index
+	})
+	return j.save()
+}
+
+func (j *jsonFile) RemovePairs(ds Dataset, indices []int64) error {
+	if err := j.load(); err != nil {
+		return err
+	}
+	if len(indices) == 0 {
+		return nil
+	}
+	remove := map[int64]bool{}
+	for _, index := range indices {
+		remove[index] = true
+	}
+	kept := make([]dex.Pair, 0, len(j.data.Tokens))
+	for _, pair := range j.data.Tokens {
+		if !remove[pair.Index] {
+			kept = append(kept, pair)
+		}
+	}
+	j.data.Tokens = kept
+	return j.save()
+}
+
+func (j *jsonFile) Cursor(ds Dataset) (*Cursor, error) {
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if j.data.Block == 0 {
+		return nil, nil
+	}
+	return &Cursor{Block: j.data.Block, Hash: j.data.BlockHash, Complete: j.data.Complete}, nil
+}
+
+// SetCursor sets the block of the file, which is written with the next change of pairs or on Close
+func (j *jsonFile) SetCursor(ds Dataset, cursor Cursor) error {
+	if err := j.load(); err != nil {
+		return err
+	}
+	if j.data.Block != cursor.Block || j.data.BlockHash != cursor.Hash || j.data.Complete != cursor.Complete {
+		j.data.Block = cursor.Block
+		j.data.BlockHash = cursor.Hash
+		j.data.Complete = cursor.Complete
+		j.dirty = true
+	}
+	return nil
+}
+
+func (j *jsonFile) SaveFailures(ds Dataset, failures []Failure) error {
+	return nil
+}
+
+func (j *jsonFile) Close() error {
+	if !j.dirty {
+		return nil
+	}
+	return j.save()
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/nikolalosic/dex-pairs/dex"
+	"golang.org/x/exp/slog"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// maxRecordSize is the longest line of a NDJSON file that can be read
+const maxRecordSize = 16 * 1024 * 1024
+
+// ndjsonRecord is a line of a NDJSON file. Every record has exactly one of its changes set.
+type ndjsonRecord struct {
+	ChainId  int        `json:"chainId"`
+	Dex      string     `json:"dex"`
+	Pair     *dex.Pair  `json:"pair,omitempty"`
+	Removed  []int64    `json:"removed,omitempty"`
+	Cursor   *Cursor    `json:"cursor,omitempty"`
+	Failures *[]Failure `json:"failures,omitempty"`
+}
+
+// ndjsonFile is a Store appending every change as a line of JSON to a file, which is never rewritten, so
+// the file can be followed by other processes. Load replays the whole file.
+type ndjsonFile struct {
+	path string
+	file *os.File
+	// cursors are the last cursors of datasets read or written
+	cursors map[Dataset]*Cursor
+	logger  *slog.Logger
+}
+
+// NewNDJSON opens the NDJSON file for appending, creating it if it does not exist
+func NewNDJSON(path string, logger *slog.Logger) (Store, error) {
+	logger = loggerOrDefault(logger)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		logger.Error("Error opening file", "file", path, "error", err)
+		return nil, err
+	}
+	// a record cut off by an interrupted write is terminated, so the next record starts on a new line
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if last[0] != '\n' {
+			if _, err := file.Write([]byte("\n")); err != nil {
+				file.Close()
+				return nil, err
+			}
+		}
+	}
+	return &ndjsonFile{path: path, file: file, cursors: map[Dataset]*Cursor{}, logger: logger}, nil
+}
+
+// Load replays the records of the dataset. Lines which are not valid records are skipped.
+func (n *ndjsonFile) Load(ds Dataset) ([]dex.Pair, error) {
+	n.logger.Info("Reading data from file", "file", n.path)
+	if _, err := n.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	pairs := map[string]dex.Pair{}
+	scanner := bufio.NewScanner(n.file)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var r ndjsonRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			n.logger.Warn("Skipping invalid record", "file", n.path, "line", line, "error", err)
+			continue
+		}
+		if r.ChainId != ds.ChainId || r.Dex != ds.Dex {
+			continue
+		}
+		if r.Pair != nil {
+			pairs[r.Pair.Address] = *r.Pair
+		}
+		if len(r.Removed) > 0 {
+			removed := map[int64]bool{}
+			for _, index := range r.Removed {
+				removed[index] = true
+			}
+			for address, pair := range pairs {
+				if removed[pair.Index] {
+					delete(pairs, address)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		n.logger.Error("Error reading file", "file", n.path, "error", err)
+		return nil, err
+	}
+	res := make([]dex.Pair, 0, len(pairs))
+	for _, pair := range pairs {
+		res = append(res, pair)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Index < res[j].Index
+	})
+	return res, nil
+}
+
+// append writes the records with a single write, so a concurrent reader never sees half of a batch
+// unless the write is interrupted
+func (n *ndjsonFile) append(records []ndjsonRecord) error {
+	var buf bytes.Buffer
+	for _, r := range records {
+		line, err := json.Marshal(r)
+		if err != nil {
+			n.logger.Error("Error marshalling record", "error", err)
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if _, err := n.file.Write(buf.Bytes()); err != nil {
+		n.logger.Error("Error writing to file", "file", n.path, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (n *ndjsonFile) UpsertPairs(ds Dataset, pairs []dex.Pair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	records := make([]ndjsonRecord, len(pairs))
+	for i := range pairs {
+		records[i] = ndjsonRecord{ChainId: ds.ChainId, Dex: ds.Dex, Pair: &pairs[i]}
+	}
+	return n.append(records)
+}
+
+func (n *ndjsonFile) RemovePairs(ds Dataset, indices []int64) error {
+	if len(indices) == 0 {
+		return nil
+	}
+	return n.append([]ndjsonRecord{{ChainId: ds.ChainId, Dex: ds.Dex, Removed: indices}})
+}
+
+// Cursor returns the last cursor record of the dataset
+func (n *ndjsonFile) Cursor(ds Dataset) (*Cursor, error) {
+	if cursor, ok := n.cursors[ds]; ok {
+		return cursor, nil
+	}
+	if _, err := n.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var cursor *Cursor
+	scanner := bufio.NewScanner(n.file)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	for scanner.Scan() {
+		var r ndjsonRecord
+		if json.Unmarshal(scanner.Bytes(), &r) != nil || r.ChainId != ds.ChainId || r.Dex != ds.Dex {
+			continue
+		}
+		if r.Cursor != nil {
+			cursor = r.Cursor
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		n.logger.Error("Error reading file", "file", n.path, "error", err)
+		return nil, err
+	}
+	n.cursors[ds] = cursor
+	return cursor, nil
+}
+
+// SetCursor appends a cursor record, unless the cursor did not change since the last one
+func (n *ndjsonFile) SetCursor(ds Dataset, cursor Cursor) error {
+	last, err := n.Cursor(ds)
+	if err != nil {
+		return err
+	}
+	if last != nil && last.Block == cursor.Block && last.Hash == cursor.Hash && last.Complete == cursor.Complete {
+		return nil
+	}
+	if cursor.UpdatedAt.IsZero() {
+		cursor.UpdatedAt = time.Now().UTC()
+	}
+	if err := n.append([]ndjsonRecord{{ChainId: ds.ChainId, Dex: ds.Dex, Cursor: &cursor}}); err != nil {
+		return err
+	}
+	n.cursors[ds] = &cursor
+	return nil
+}
+
+func (n *ndjsonFile) SaveFailures(ds Dataset, failures []Failure) error {
+	return n.append([]ndjsonRecord{{ChainId: ds.ChainId, Dex: ds.Dex, Failures: &failures}})
+}
+
+func (n *ndjsonFile) Close() error {
+	return n.file.Close()
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"database/sql"
+	_ "github.com/lib/pq"
+	"golang.org/x/exp/slog"
+)
+
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS pairs (
+		chain_id BIGINT NOT NULL,
+		address TEXT NOT NULL,
+		dex TEXT NOT NULL,
+		pair_index BIGINT NOT NULL,
+		token0 TEXT NOT NULL,
+		token1 TEXT NOT NULL,
+		name TEXT NOT NULL,
+		symbol TEXT NOT NULL,
+		decimals INTEGER NOT NULL,
+		fee BIGINT NOT NULL,
+		tick_spacing BIGINT NOT NULL,
+		state TEXT,
+		block_number BIGINT NOT NULL,
+		block_hash TEXT NOT NULL,
+		pending BOOLEAN NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (chain_id, address)
+	)`,
+	`CREATE INDEX IF NOT EXISTS pairs_dex_index ON pairs (chain_id, dex, pair_index)`,
+	`CREATE INDEX IF NOT EXISTS pairs_token0 ON pairs (chain_id, token0)`,
+	`CREATE INDEX IF NOT EXISTS pairs_token1 ON pairs (chain_id, token1)`,
+	`CREATE TABLE IF NOT EXISTS tokens (
+		chain_id BIGINT NOT NULL,
+		address TEXT NOT NULL,
+		symbol TEXT NOT NULL,
+		name TEXT NOT NULL,
+		decimals INTEGER NOT NULL,
+		total_supply TEXT NOT NULL,
+		raw_symbol TEXT NOT NULL,
+		raw_name TEXT NOT NULL,
+		symbol_fallbacks TEXT NOT NULL,
+		name_fallbacks TEXT NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (chain_id, address)
+	)`,
+	`CREATE TABLE IF NOT EXISTS cursors (
+		chain_id BIGINT NOT NULL,
+		dex TEXT NOT NULL,
+		block BIGINT NOT NULL,
+		hash TEXT NOT NULL,
+		complete BOOLEAN NOT NULL DEFAULT FALSE,
+		updated_at TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (chain_id, dex)
+	)`,
+	// cursors of databases created before exports were marked complete
+	`ALTER TABLE cursors ADD COLUMN IF NOT EXISTS complete BOOLEAN NOT NULL DEFAULT FALSE`,
+	`CREATE TABLE IF NOT EXISTS failures (
+		chain_id BIGINT NOT NULL,
+		dex TEXT NOT NULL,
+		pair_index BIGINT NOT NULL,
+		class TEXT NOT NULL,
+		error TEXT NOT NULL,
+		PRIMARY KEY (chain_id, dex, pair_index)
+	)`,
+}
+
+// NewPostgres connects to the Postgres database at the URL and creates its tables if they do not exist
+func NewPostgres(url string, logger *slog.Logger) (Store, error) {
+	logger = loggerOrDefault(logger)
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		logger.Error("Error opening Postgres database", "error", err)
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		logger.Error("Error connecting to Postgres database", "error", err)
+		db.Close()
+		return nil, err
+	}
+	s, err := newSQLStore(db, postgresSchema, logger)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
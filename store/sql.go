@@ -0,0 +1,284 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/dex"
+	"golang.org/x/exp/slog"
+	"strings"
+	"time"
+)
+
+// sqlStore is a Store over a SQL database. Statements use $n placeholders and ON CONFLICT upserts.
+type sqlStore struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// newSQLStore creates the tables of the schema if they do not exist
+func newSQLStore(db *sql.DB, schema []string, logger *slog.Logger) (*sqlStore, error) {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			logger.Error("Error creating schema", "error", err)
+			return nil, err
+		}
+	}
+	return &sqlStore{db: db, logger: logger}, nil
+}
+
+const pairColumns = `p.pair_index, p.token0, p.token1, p.name, p.address, p.symbol, p.decimals, p.chain_id, p.fee,
+	p.tick_spacing, p.state, p.block_number, p.block_hash, p.pending`
+
+const tokenColumns = `address, symbol, name, decimals, total_supply, raw_symbol, raw_name, symbol_fallbacks,
+	name_fallbacks`
+
+func (s *sqlStore) Load(ds Dataset) ([]dex.Pair, error) {
+	rows, err := s.db.Query(`
+		SELECT `+pairColumns+`,
+			`+prefixColumns("t0", tokenColumns)+`,
+			`+prefixColumns("t1", tokenColumns)+`
+		FROM pairs p
+		LEFT JOIN tokens t0 ON t0.chain_id = p.chain_id AND t0.address = p.token0
+		LEFT JOIN tokens t1 ON t1.chain_id = p.chain_id AND t1.address = p.token1
+		WHERE p.chain_id = $1 AND p.dex = $2
+		ORDER BY p.pair_index`,
+		ds.ChainId, ds.Dex,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []dex.Pair
+	for rows.Next() {
+		var pair dex.Pair
+		var state sql.NullString
+		var token0, token1 nullToken
+		dest := []interface{}{
+			&pair.Index, &pair.Token0, &pair.Token1, &pair.Name, &pair.Address, &pair.Symbol, &pair.Decimals,
+			&pair.ChainId, &pair.Fee, &pair.TickSpacing, &state, &pair.BlockNumber, &pair.BlockHash, &pair.Pending,
+		}
+		dest = append(dest, token0.dest()...)
+		dest = append(dest, token1.dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if state.Valid {
+			pair.State = &dex.PairState{}
+			if err := json.Unmarshal([]byte(state.String), pair.State); err != nil {
+				return nil, err
+			}
+		}
+		if pair.Token0Info, err = token0.token(); err != nil {
+			return nil, err
+		}
+		if pair.Token1Info, err = token1.token(); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, rows.Err()
+}
+
+func (s *sqlStore) UpsertPairs(ds Dataset, pairs []dex.Pair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	pairStmt, err := tx.Prepare(`
+		INSERT INTO pairs (chain_id, address, dex, pair_index, token0, token1, name, symbol, decimals, fee,
+			tick_spacing, state, block_number, block_hash, pending, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (chain_id, address) DO UPDATE SET
+			dex = excluded.dex, pair_index = excluded.pair_index, token0 = excluded.token0,
+			token1 = excluded.token1, name = excluded.name, symbol = excluded.symbol, decimals = excluded.decimals,
+			fee = excluded.fee, tick_spacing = excluded.tick_spacing, state = excluded.state,
+			block_number = excluded.block_number, block_hash = excluded.block_hash, pending = excluded.pending,
+			updated_at = excluded.updated_at`,
+	)
+	if err != nil {
+		return err
+	}
+	defer pairStmt.Close()
+	tokenStmt, err := tx.Prepare(`
+		INSERT INTO tokens (chain_id, ` + tokenColumns + `, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (chain_id, address) DO UPDATE SET
+			symbol = excluded.symbol, name = excluded.name, decimals = excluded.decimals,
+			total_supply = excluded.total_supply, raw_symbol = excluded.raw_symbol, raw_name = excluded.raw_name,
+			symbol_fallbacks = excluded.symbol_fallbacks, name_fallbacks = excluded.name_fallbacks,
+			updated_at = excluded.updated_at`,
+	)
+	if err != nil {
+		return err
+	}
+	defer tokenStmt.Close()
+
+	now := time.Now().UTC()
+	tokens := map[string]*dex.Token{}
+	for _, pair := range pairs {
+		var state interface{}
+		if pair.State != nil {
+			encoded, err := json.Marshal(pair.State)
+			if err != nil {
+				return err
+			}
+			state = string(encoded)
+		}
+		_, err := pairStmt.Exec(
+			ds.ChainId, pair.Address, ds.Dex, pair.Index, pair.Token0, pair.Token1, pair.Name, pair.Symbol,
+			pair.Decimals, pair.Fee, pair.TickSpacing, state, pair.BlockNumber, pair.BlockHash, pair.Pending, now,
+		)
+		if err != nil {
+			s.logger.Error("Error upserting pair", "pairIndex", pair.Index, "pairAddress", pair.Address, "error", err)
+			return err
+		}
+		for _, t := range []*dex.Token{pair.Token0Info, pair.Token1Info} {
+			if t != nil {
+				tokens[t.Address] = t
+			}
+		}
+	}
+	for _, t := range tokens {
+		symbolFallbacks, _ := json.Marshal(t.SymbolFallbacks)
+		nameFallbacks, _ := json.Marshal(t.NameFallbacks)
+		_, err := tokenStmt.Exec(
+			ds.ChainId, t.Address, t.Symbol, t.Name, t.Decimals, t.TotalSupply, t.RawSymbol, t.RawName,
+			string(symbolFallbacks), string(nameFallbacks), now,
+		)
+		if err != nil {
+			s.logger.Error("Error upserting token", "token", t.Address, "error", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) RemovePairs(ds Dataset, indices []int64) error {
+	if len(indices) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, index := range indices {
+		_, err := tx.Exec(
+			`DELETE FROM pairs WHERE chain_id = $1 AND dex = $2 AND pair_index = $3`, ds.ChainId, ds.Dex, index,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Cursor(ds Dataset) (*Cursor, error) {
+	var cursor Cursor
+	err := s.db.QueryRow(
+		`SELECT block, hash, complete, updated_at FROM cursors WHERE chain_id = $1 AND dex = $2`, ds.ChainId, ds.Dex,
+	).Scan(&cursor.Block, &cursor.Hash, &cursor.Complete, &cursor.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func (s *sqlStore) SetCursor(ds Dataset, cursor Cursor) error {
+	if cursor.UpdatedAt.IsZero() {
+		cursor.UpdatedAt = time.Now().UTC()
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO cursors (chain_id, dex, block, hash, complete, updated_at) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (chain_id, dex) DO UPDATE SET
+			block = excluded.block, hash = excluded.hash, complete = excluded.complete, updated_at = excluded.updated_at`,
+		ds.ChainId, ds.Dex, cursor.Block, cursor.Hash, cursor.Complete, cursor.UpdatedAt,
+	)
+	return err
+}
+
+func (s *sqlStore) SaveFailures(ds Dataset, failures []Failure) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM failures WHERE chain_id = $1 AND dex = $2`, ds.ChainId, ds.Dex); err != nil {
+		return err
+	}
+	for _, f := range failures {
+		_, err := tx.Exec(
+			`INSERT INTO failures (chain_id, dex, pair_index, class, error) VALUES ($1, $2, $3, $4, $5)`,
+			ds.ChainId, ds.Dex, f.Index, f.Class, f.Error,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// prefixColumns qualifies comma separated columns with the table alias
+func prefixColumns(alias string, columns string) string {
+	var res []string
+	for _, c := range strings.Split(columns, ",") {
+		res = append(res, fmt.Sprintf("%s.%s", alias, strings.TrimSpace(c)))
+	}
+	return strings.Join(res, ", ")
+}
+
+// nullToken is a token scanned from a LEFT JOIN, all columns are NULL when the token is not stored
+type nullToken struct {
+	address, symbol, name, totalSupply, rawSymbol, rawName, symbolFallbacks, nameFallbacks sql.NullString
+	decimals                                                                               sql.NullInt64
+}
+
+func (t *nullToken) dest() []interface{} {
+	return []interface{}{
+		&t.address, &t.symbol, &t.name, &t.decimals, &t.totalSupply, &t.rawSymbol, &t.rawName,
+		&t.symbolFallbacks, &t.nameFallbacks,
+	}
+}
+
+func (t *nullToken) token() (*dex.Token, error) {
+	if !t.address.Valid {
+		return nil, nil
+	}
+	token := &dex.Token{
+		Address:     t.address.String,
+		Symbol:      t.symbol.String,
+		Name:        t.name.String,
+		Decimals:    int(t.decimals.Int64),
+		TotalSupply: t.totalSupply.String,
+		RawSymbol:   t.rawSymbol.String,
+		RawName:     t.rawName.String,
+	}
+	if err := unmarshalList(t.symbolFallbacks, &token.SymbolFallbacks); err != nil {
+		return nil, err
+	}
+	if err := unmarshalList(t.nameFallbacks, &token.NameFallbacks); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func unmarshalList(value sql.NullString, list *[]string) error {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(value.String), list)
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"golang.org/x/exp/slog"
+	_ "modernc.org/sqlite"
+)
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS pairs (
+		chain_id INTEGER NOT NULL,
+		address TEXT NOT NULL,
+		dex TEXT NOT NULL,
+		pair_index INTEGER NOT NULL,
+		token0 TEXT NOT NULL,
+		token1 TEXT NOT NULL,
+		name TEXT NOT NULL,
+		symbol TEXT NOT NULL,
+		decimals INTEGER NOT NULL,
+		fee INTEGER NOT NULL,
+		tick_spacing INTEGER NOT NULL,
+		state TEXT,
+		block_number INTEGER NOT NULL,
+		block_hash TEXT NOT NULL,
+		pending BOOLEAN NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (chain_id, address)
+	)`,
+	`CREATE INDEX IF NOT EXISTS pairs_dex_index ON pairs (chain_id, dex, pair_index)`,
+	`CREATE INDEX IF NOT EXISTS pairs_token0 ON pairs (chain_id, token0)`,
+	`CREATE INDEX IF NOT EXISTS pairs_token1 ON pairs (chain_id, token1)`,
+	`CREATE TABLE IF NOT EXISTS tokens (
+		chain_id INTEGER NOT NULL,
+		address TEXT NOT NULL,
+		symbol TEXT NOT NULL,
+		name TEXT NOT NULL,
+		decimals INTEGER NOT NULL,
+		total_supply TEXT NOT NULL,
+		raw_symbol TEXT NOT NULL,
+		raw_name TEXT NOT NULL,
+		symbol_fallbacks TEXT NOT NULL,
+		name_fallbacks TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (chain_id, address)
+	)`,
+	`CREATE TABLE IF NOT EXISTS cursors (
+		chain_id INTEGER NOT NULL,
+		dex TEXT NOT NULL,
+		block INTEGER NOT NULL,
+		hash TEXT NOT NULL,
+		complete BOOLEAN NOT NULL DEFAULT FALSE,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (chain_id, dex)
+	)`,
+	`CREATE TABLE IF NOT EXISTS failures (
+		chain_id INTEGER NOT NULL,
+		dex TEXT NOT NULL,
+		pair_index INTEGER NOT NULL,
+		class TEXT NOT NULL,
+		error TEXT NOT NULL,
+		PRIMARY KEY (chain_id, dex, pair_index)
+	)`,
+}
+
+// NewSQLite opens the SQLite database file, creating it and its tables if they do not exist
+func NewSQLite(path string, logger *slog.Logger) (Store, error) {
+	logger = loggerOrDefault(logger)
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)")
+	if err != nil {
+		logger.Error("Error opening SQLite database", "file", path, "error", err)
+		return nil, err
+	}
+	// a single connection serializes writes, which SQLite does not run concurrently anyway
+	db.SetMaxOpenConns(1)
+	s, err := newSQLStore(db, sqliteSchema, logger)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// cursors of databases created before exports were marked complete
+	if err := addSQLiteColumn(db, "cursors", "complete", "BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+		logger.Error("Error migrating schema", "error", err)
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// addSQLiteColumn adds the column to the table unless the table already has it, as SQLite has no
+// ADD COLUMN IF NOT EXISTS
+func addSQLiteColumn(db *sql.DB, table string, column string, definition string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info($1)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/dex"
+	"golang.org/x/exp/slog"
+	"strings"
+	"time"
+)
+
+// Dataset identifies the pairs of a DEX deployment on a chain
+type Dataset struct {
+	ChainId int
+	// Dex is the name and version of the DEX, e.g. uniswap_v2
+	Dex string
+}
+
+// Cursor is the block a dataset was last synced at
+type Cursor struct {
+	Block uint64 `json:"block"`
+	Hash  string `json:"hash"`
+	// Complete is set once the export at Block ran all of its jobs, so the next export moves on to a newer block
+	// instead of resuming at Block
+	Complete  bool      `json:"complete,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Failure is a pair that could not be fetched even after retries
+type Failure struct {
+	Index int64  `json:"index"`
+	Class string `json:"class"`
+	Error string `json:"error"`
+}
+
+// Store persists pairs, their tokens, sync cursors and failures of datasets
+type Store interface {
+	// Load returns all pairs of the dataset sorted by index
+	Load(ds Dataset) ([]dex.Pair, error)
+	// UpsertPairs adds pairs to the dataset, replacing stored pairs with the same chain id and address,
+	// and upserts their tokens
+	UpsertPairs(ds Dataset, pairs []dex.Pair) error
+	// RemovePairs removes pairs of the dataset by index
+	RemovePairs(ds Dataset, indices []int64) error
+	// Cursor returns the cursor of the dataset, or nil if it was never synced
+	Cursor(ds Dataset) (*Cursor, error)
+	// SetCursor sets the cursor of the dataset
+	SetCursor(ds Dataset, cursor Cursor) error
+	// SaveFailures replaces the failures of the dataset
+	SaveFailures(ds Dataset, failures []Failure) error
+	// Close releases the store
+	Close() error
+}
+
+// Open opens the store at the URL. The scheme selects the backend: json://path, ndjson://path,
+// sqlite://path, or a postgres:// or postgresql:// connection URL. A nil logger defaults to slog.Default.
+func Open(url string, logger *slog.Logger) (Store, error) {
+	i := strings.Index(url, "://")
+	if i < 0 {
+		return nil, fmt.Errorf("store %s has no scheme", url)
+	}
+	scheme, path := url[:i], url[i+3:]
+	switch scheme {
+	case "json":
+		return NewJSONFile(path, path, logger), nil
+	case "ndjson":
+		return NewNDJSON(path, logger)
+	case "sqlite":
+		return NewSQLite(path, logger)
+	case "postgres", "postgresql":
+		return NewPostgres(url, logger)
+	default:
+		return nil, fmt.Errorf("unknown store scheme %s", scheme)
+	}
+}
+
+// loggerOrDefault returns the logger, or slog.Default if it is nil
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
+
+// Copy writes the pairs and the cursor of the dataset in src to dst
+func Copy(dst Store, src Store, ds Dataset) error {
+	pairs, err := src.Load(ds)
+	if err != nil {
+		return err
+	}
+	cursor, err := src.Cursor(ds)
+	if err != nil {
+		return err
+	}
+	if cursor != nil {
+		if err := dst.SetCursor(ds, *cursor); err != nil {
+			return err
+		}
+	}
+	return dst.UpsertPairs(ds, pairs)
+}
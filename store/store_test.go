@@ -0,0 +1,292 @@
+package store
+
+import (
+	"database/sql"
+	"github.com/nikolalosic/dex-pairs/dex"
+	"golang.org/x/exp/slog"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	testLogger  = slog.New(slog.NewTextHandler(io.Discard, nil))
+	testDataset = Dataset{ChainId: 1, Dex: "uniswap_v2"}
+)
+
+// testBackend opens a store of the backend at the same location on every call of open
+type testBackend struct {
+	name string
+	open func(t *testing.T) Store
+	// multiDataset is set on backends keeping datasets apart
+	multiDataset bool
+}
+
+func testBackends(t *testing.T) []testBackend {
+	dir := t.TempDir()
+	backends := []testBackend{
+		{name: "json", open: func(t *testing.T) Store {
+			return NewJSONFile(filepath.Join(dir, "pairs.json"), filepath.Join(dir, "pairs.json"), testLogger)
+		}},
+		{name: "ndjson", multiDataset: true, open: func(t *testing.T) Store {
+			s, err := NewNDJSON(filepath.Join(dir, "pairs.ndjson"), testLogger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}},
+		{name: "sqlite", multiDataset: true, open: func(t *testing.T) Store {
+			s, err := NewSQLite(filepath.Join(dir, "pairs.db"), testLogger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}},
+	}
+	// Postgres is only tested against a database given in the environment, which has to be empty
+	if url := os.Getenv("DEX_PAIRS_TEST_POSTGRES"); url != "" {
+		backends = append(backends, testBackend{name: "postgres", multiDataset: true, open: func(t *testing.T) Store {
+			s, err := NewPostgres(url, testLogger)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}})
+	}
+	return backends
+}
+
+func testPair(index int64, address string) dex.Pair {
+	return dex.Pair{
+		Index:    index,
+		Token0:   "0x0000000000000000000000000000000000000a" + address[len(address)-2:],
+		Token1:   "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2",
+		Name:     "Uniswap V2 - TKN/WETH",
+		Address:  address,
+		Symbol:   "UNI-V2",
+		Decimals: 18,
+		ChainId:  1,
+		Token0Info: &dex.Token{
+			Address: "0x0000000000000000000000000000000000000a" + address[len(address)-2:], Symbol: "TKN",
+			Name: "Token", Decimals: 6, TotalSupply: "1000",
+		},
+		Token1Info: &dex.Token{
+			Address: "0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2", Symbol: "WETH", Name: "Wrapped Ether",
+			Decimals: 18, TotalSupply: "2000",
+		},
+	}
+}
+
+func loadPairs(t *testing.T, s Store, ds Dataset) []dex.Pair {
+	pairs, err := s.Load(ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pairs
+}
+
+func TestStores(t *testing.T) {
+	for _, backend := range testBackends(t) {
+		t.Run(backend.name, func(t *testing.T) {
+			testStore(t, backend)
+		})
+	}
+}
+
+func testStore(t *testing.T, backend testBackend) {
+	s := backend.open(t)
+
+	if pairs := loadPairs(t, s, testDataset); len(pairs) != 0 {
+		t.Fatalf("expected no pairs, got %d", len(pairs))
+	}
+	cursor, err := s.Cursor(testDataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor != nil {
+		t.Fatalf("expected no cursor, got %+v", cursor)
+	}
+
+	// pairs are loaded sorted by index
+	p0, p1, p2 := testPair(0, "0x00000000000000000000000000000000000000b0"),
+		testPair(1, "0x00000000000000000000000000000000000000b1"), testPair(2, "0x00000000000000000000000000000000000000b2")
+	if err := s.UpsertPairs(testDataset, []dex.Pair{p2, p0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpsertPairs(testDataset, []dex.Pair{p1}); err != nil {
+		t.Fatal(err)
+	}
+	if pairs := loadPairs(t, s, testDataset); !reflect.DeepEqual(pairs, []dex.Pair{p0, p1, p2}) {
+		t.Fatalf("unexpected pairs %+v", pairs)
+	}
+
+	// a pair with a stored address replaces the stored pair
+	p1 = testPair(1, p1.Address)
+	p1.Name = "Uniswap V2 - TKN2/WETH"
+	p1.Token0Info.Symbol = "TKN2"
+	if err := s.UpsertPairs(testDataset, []dex.Pair{p1}); err != nil {
+		t.Fatal(err)
+	}
+	if pairs := loadPairs(t, s, testDataset); !reflect.DeepEqual(pairs, []dex.Pair{p0, p1, p2}) {
+		t.Fatalf("unexpected pairs after replacing pair 1 %+v", pairs)
+	}
+
+	if err := s.RemovePairs(testDataset, []int64{0, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if pairs := loadPairs(t, s, testDataset); !reflect.DeepEqual(pairs, []dex.Pair{p1}) {
+		t.Fatalf("unexpected pairs after removing pairs 0 and 2 %+v", pairs)
+	}
+
+	if err := s.SetCursor(testDataset, Cursor{Block: 100, Hash: "0xaa", UpdatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetCursor(testDataset, Cursor{Block: 120, Hash: "0xbb", Complete: true, UpdatedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures := []Failure{{Index: 3, Class: "retryable", Error: "http status 503"}}
+	if err := s.SaveFailures(testDataset, failures); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveFailures(testDataset, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	other := Dataset{ChainId: 56, Dex: "pancake_swap"}
+	otherPair := testPair(0, p0.Address)
+	otherPair.ChainId = other.ChainId
+	if backend.multiDataset {
+		if err := s.UpsertPairs(other, []dex.Pair{otherPair}); err != nil {
+			t.Fatal(err)
+		}
+		if pairs := loadPairs(t, s, testDataset); !reflect.DeepEqual(pairs, []dex.Pair{p1}) {
+			t.Fatalf("unexpected pairs after adding a pair to another dataset %+v", pairs)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// pairs and the cursor survive reopening the store
+	s = backend.open(t)
+	defer s.Close()
+	if pairs := loadPairs(t, s, testDataset); !reflect.DeepEqual(pairs, []dex.Pair{p1}) {
+		t.Fatalf("unexpected pairs after reopening %+v", pairs)
+	}
+	cursor, err = s.Cursor(testDataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor == nil || cursor.Block != 120 || cursor.Hash != "0xbb" || !cursor.Complete {
+		t.Fatalf("unexpected cursor after reopening %+v", cursor)
+	}
+	if backend.multiDataset {
+		if pairs := loadPairs(t, s, other); !reflect.DeepEqual(pairs, []dex.Pair{otherPair}) {
+			t.Fatalf("unexpected pairs of another dataset %+v", pairs)
+		}
+		if cursor, err := s.Cursor(other); err != nil || cursor != nil {
+			t.Fatalf("expected no cursor of another dataset, got %+v, %v", cursor, err)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	for _, url := range []string{
+		"json://" + filepath.Join(dir, "pairs.json"),
+		"ndjson://" + filepath.Join(dir, "pairs.ndjson"),
+		"sqlite://" + filepath.Join(dir, "pairs.db"),
+	} {
+		s, err := Open(url, testLogger)
+		if err != nil {
+			t.Errorf("%s: %v", url, err)
+			continue
+		}
+		s.Close()
+	}
+	for _, url := range []string{"pairs.json", "mysql://localhost/pairs"} {
+		if _, err := Open(url, testLogger); err == nil {
+			t.Errorf("%s: expected error", url)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	dir := t.TempDir()
+	src, err := NewNDJSON(filepath.Join(dir, "pairs.ndjson"), testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	pairs := []dex.Pair{
+		testPair(0, "0x00000000000000000000000000000000000000b0"),
+		testPair(1, "0x00000000000000000000000000000000000000b1"),
+	}
+	if err := src.UpsertPairs(testDataset, pairs); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetCursor(testDataset, Cursor{Block: 100, Hash: "0xaa"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := NewSQLite(filepath.Join(dir, "pairs.db"), testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if err := Copy(dst, src, testDataset); err != nil {
+		t.Fatal(err)
+	}
+	if copied := loadPairs(t, dst, testDataset); !reflect.DeepEqual(copied, pairs) {
+		t.Errorf("unexpected copied pairs %+v", copied)
+	}
+	if cursor, err := dst.Cursor(testDataset); err != nil || cursor == nil || cursor.Block != 100 {
+		t.Errorf("unexpected copied cursor %+v, %v", cursor, err)
+	}
+}
+
+func TestSQLiteMigratesCursors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pairs.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the cursors table as created before exports were marked complete
+	_, err = db.Exec(`CREATE TABLE cursors (
+		chain_id INTEGER NOT NULL,
+		dex TEXT NOT NULL,
+		block INTEGER NOT NULL,
+		hash TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (chain_id, dex)
+	)`)
+	if err == nil {
+		_, err = db.Exec(
+			`INSERT INTO cursors (chain_id, dex, block, hash, updated_at) VALUES ($1, $2, $3, $4, $5)`,
+			testDataset.ChainId, testDataset.Dex, 100, "0xaa", time.Now(),
+		)
+	}
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		s, err := NewSQLite(path, testLogger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursor, err := s.Cursor(testDataset)
+		s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cursor == nil || cursor.Block != 100 || cursor.Complete {
+			t.Fatalf("unexpected cursor %+v", cursor)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nikolalosic/dex-pairs/dex"
+	"github.com/xeipuuv/gojsonschema"
+	"golang.org/x/exp/slog"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenListSchema is the tokenlists.org JSON schema token lists are validated against
+//
+//go:embed tokenlist.schema.json
+var tokenListSchema string
+
+const tokenListSchemaId = "https://uniswap.org/tokenlist.schema.json"
+
+// maxTokenListNameLength is the maximum length of a token list name allowed by the schema
+const maxTokenListNameLength = 30
+
+// maxTokenListTokens is the maximum number of tokens of a token list allowed by the schema
+const maxTokenListTokens = 10000
+
+var tokenListNameRegex = regexp.MustCompile(`[^\w ]+`)
+
+// errInvalidTokenList is returned when the token list is not allowed by the schema after invalid tokens are dropped
+var errInvalidTokenList = errors.New("invalid token list")
+
+type tokenList struct {
+	Name      string      `json:"name"`
+	Timestamp time.Time   `json:"timestamp"`
+	Version   version     `json:"version"`
+	Keywords  []string    `json:"keywords,omitempty"`
+	Tokens    []tokenInfo `json:"tokens"`
+}
+
+type tokenInfo struct {
+	ChainId  int    `json:"chainId"`
+	Address  string `json:"address"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+	LogoURI  string `json:"logoURI,omitempty"`
+}
+
+// getTokenList returns the token list of the unique tokens of all pairs. logoURITemplate is the URI of
+// token logos, with {chainId} and {address} replaced by the chain id and the token address.
+func getTokenList(name string, pairs []dex.Pair, logoURITemplate string) *tokenList {
+	tokens := map[string]tokenInfo{}
+	for _, pair := range pairs {
+		for _, t := range []*dex.Token{pair.Token0Info, pair.Token1Info} {
+			if t == nil || t.Address == strings.ToLower(dex.EthAddress.String()) {
+				continue
+			}
+			ti := tokenInfo{
+				ChainId:  pair.ChainId,
+				Address:  t.Address,
+				Name:     t.Name,
+				Symbol:   t.Symbol,
+				Decimals: t.Decimals,
+			}
+			if logoURITemplate != "" {
+				ti.LogoURI = strings.NewReplacer(
+					"{chainId}", strconv.Itoa(pair.ChainId), "{address}", t.Address,
+				).Replace(logoURITemplate)
+			}
+			tokens[fmt.Sprintf("%d_%s", ti.ChainId, ti.Address)] = ti
+		}
+	}
+
+	list := &tokenList{
+		Name:      tokenListName(name),
+		Timestamp: time.Now().UTC(),
+		Version:   version{Major: 1},
+		Tokens:    make([]tokenInfo, 0, len(tokens)),
+	}
+	for _, t := range tokens {
+		list.Tokens = append(list.Tokens, t)
+	}
+	sort.Slice(list.Tokens, func(i, j int) bool {
+		if list.Tokens[i].ChainId != list.Tokens[j].ChainId {
+			return list.Tokens[i].ChainId < list.Tokens[j].ChainId
+		}
+		return list.Tokens[i].Address < list.Tokens[j].Address
+	})
+	return list
+}
+
+// tokenListName strips characters and length not allowed in token list names
+func tokenListName(name string) string {
+	name = strings.TrimSpace(tokenListNameRegex.ReplaceAllString(name, ""))
+	if len(name) > maxTokenListNameLength {
+		name = strings.TrimSpace(name[:maxTokenListNameLength])
+	}
+	return name
+}
+
+// splitTokenList splits a list with more tokens than the schema allows into lists of at most
+// maxTokenListTokens tokens. The first part keeps the name of the list, the others are numbered from 2 on.
+func splitTokenList(list *tokenList) []*tokenList {
+	if len(list.Tokens) <= maxTokenListTokens {
+		return []*tokenList{list}
+	}
+	var parts []*tokenList
+	for start := 0; start < len(list.Tokens); start += maxTokenListTokens {
+		end := start + maxTokenListTokens
+		if end > len(list.Tokens) {
+			end = len(list.Tokens)
+		}
+		part := *list
+		part.Tokens = list.Tokens[start:end]
+		if n := len(parts) + 1; n > 1 {
+			suffix := fmt.Sprintf(" %d", n)
+			name := list.Name
+			if len(name) > maxTokenListNameLength-len(suffix) {
+				name = strings.TrimSpace(name[:maxTokenListNameLength-len(suffix)])
+			}
+			part.Name = name + suffix
+		}
+		parts = append(parts, &part)
+	}
+	return parts
+}
+
+// tokenListPartFile returns the file of the n-th part of a split token list. The first part is written to
+// fileName, the others to fileName with the part number before the extension, e.g. tokens-2.json.
+func tokenListPartFile(fileName string, n int) string {
+	if n == 1 {
+		return fileName
+	}
+	ext := filepath.Ext(fileName)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(fileName, ext), n, ext)
+}
+
+// validateTokenList drops tokens not allowed by the token list schema, then validates each part of the list
+// split by splitTokenList
+func validateTokenList(list *tokenList) ([]*tokenList, error) {
+	loader := gojsonschema.NewSchemaLoader()
+	loader.Validate = true
+	if err := loader.AddSchemas(gojsonschema.NewStringLoader(tokenListSchema)); err != nil {
+		return nil, err
+	}
+	tokenSchema, err := loader.Compile(
+		gojsonschema.NewStringLoader(fmt.Sprintf(`{"$ref": "%s#/definitions/TokenInfo"}`, tokenListSchemaId)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	valid := list.Tokens[:0]
+	skipped := 0
+	for _, t := range list.Tokens {
+		res, err := tokenSchema.Validate(gojsonschema.NewGoLoader(t))
+		if err != nil {
+			return nil, err
+		}
+		if !res.Valid() {
+			slog.Debug("Skipping token not allowed in token list", "token", t.Address, "error", schemaErrors(res))
+			skipped++
+			continue
+		}
+		valid = append(valid, t)
+	}
+	list.Tokens = valid
+	if skipped > 0 {
+		slog.Warn("Skipped tokens not allowed in token list", "tokens", skipped)
+	}
+
+	listSchema, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(tokenListSchema))
+	if err != nil {
+		return nil, err
+	}
+	parts := splitTokenList(list)
+	for _, part := range parts {
+		res, err := listSchema.Validate(gojsonschema.NewGoLoader(part))
+		if err != nil {
+			return nil, err
+		}
+		if !res.Valid() {
+			return nil, fmt.Errorf("%w: %s", errInvalidTokenList, schemaErrors(res))
+		}
+	}
+	return parts, nil
+}
+
+func schemaErrors(res *gojsonschema.Result) string {
+	var errs []string
+	for _, e := range res.Errors() {
+		errs = append(errs, e.String())
+	}
+	return strings.Join(errs, "; ")
+}
+
+// saveTokenList validates the token list and writes it to a file. A list with more tokens than the schema
+// allows is split into several lists, written to the files returned by tokenListPartFile. A list the schema
+// does not allow is not written and the file is left as it is.
+func saveTokenList(list *tokenList, fileName string) error {
+	slog.Info("Saving token list", "tokens", len(list.Tokens), "file", fileName)
+	parts, err := validateTokenList(list)
+	if err != nil {
+		slog.Error("Error validating token list", "error", err)
+		return err
+	}
+	if len(parts) > 1 {
+		slog.Info("Splitting token list", "parts", len(parts), "maxTokens", maxTokenListTokens)
+	}
+	for i, part := range parts {
+		if err := writeTokenList(part, tokenListPartFile(fileName, i+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTokenList(list *tokenList, fileName string) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		slog.Error("Error marshalling token list", "error", err)
+		return err
+	}
+	tmpFileName := fileName + ".tmp"
+	err = ioutil.WriteFile(tmpFileName, data, 0644)
+	if err != nil {
+		slog.Error("Error writing to file", "file", tmpFileName, "error", err)
+		return err
+	}
+	return os.Rename(tmpFileName, fileName)
+}